@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/location"
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+var dir = flag.String("dir", "", "Directory of archived copies of Tesla's findus page, each named after when it was taken such as 20170115083000.html")
+
+// snapshotTimeRe matches the timestamp snapshots are named after, the
+// Wayback Machine's 14 digits or just the date.
+var snapshotTimeRe = regexp.MustCompile(`^(\d{14}|\d{8})`)
+
+func main() {
+	flag.Parse()
+
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "Provide the directory of archived snapshots with --dir")
+		os.Exit(2)
+	}
+
+	err := metrics.Connect()
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = database.Connect()
+	if err != nil {
+		panic(err)
+	}
+
+	history, err := readSnapshots(*dir)
+	if err != nil {
+		panic(err)
+	}
+
+	ids, err := location.Backfill(history)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Backfilled %d locations from %d first seen in the snapshots\n", len(ids), len(history.FirstSeen))
+}
+
+// readSnapshots builds the history of the snapshots in dir, skipping files
+// that aren't named after a time or don't have any superchargers.
+func readSnapshots(dir string) (*location.History, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, f := range files {
+		if !f.IsDir() {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	history := location.NewHistory()
+	for _, name := range names {
+		takenAt, ok := snapshotTime(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Skipping %s, it isn't named after when it was taken\n", name)
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		superchargers, err := supercharger.Parse(b)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", name, err)
+			continue
+		}
+
+		history.Add(takenAt, superchargers)
+	}
+
+	return history, nil
+}
+
+func snapshotTime(name string) (time.Time, bool) {
+	match := snapshotTimeRe.FindString(name)
+	layout := "20060102150405"
+	if len(match) == 8 {
+		layout = "20060102"
+	}
+
+	t, err := time.Parse(layout, match)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
@@ -0,0 +1,21 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE sync_approvals (
+  id serial primary key,
+  snapshot_hash varchar(64) not null,
+  reasons jsonb not null, -- array
+  total integer not null,
+  previous_total integer not null,
+  added integer not null,
+  updated integer not null,
+  removed integer not null,
+  approved_at timestamp(3) null,
+  created_at timestamp(3) not null
+);
+
+CREATE INDEX index_sync_approvals_on_snapshot_hash ON sync_approvals(snapshot_hash);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE sync_approvals;
@@ -0,0 +1,22 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE sync_runs (
+  id serial primary key,
+  status varchar(20) not null,
+  source varchar(100) not null,
+  snapshot_hash varchar(64) null,
+  added integer not null default 0,
+  updated integer not null default 0,
+  unchanged integer not null default 0,
+  removed integer not null default 0,
+  error text null,
+  started_at timestamp(3) not null,
+  finished_at timestamp(3) null
+);
+
+CREATE INDEX index_sync_runs_on_status_and_finished_at ON sync_runs(status, finished_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE sync_runs;
@@ -0,0 +1,36 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE webhooks (
+  id serial primary key,
+  url text not null,
+  secret varchar(64) not null,
+  events jsonb not null, -- array
+  location_types jsonb not null, -- array
+  countries jsonb not null, -- array
+  regions jsonb not null, -- array
+  active bool not null default true,
+  updated_at timestamp(3) not null,
+  created_at timestamp(3) not null
+);
+
+CREATE TABLE webhook_deliveries (
+  id serial primary key,
+  webhook_id integer not null references webhooks(id) on delete cascade,
+  guid varchar(32) not null unique,
+  event varchar(20) not null,
+  nid integer not null,
+  payload jsonb not null,
+  status_code integer null,
+  attempts integer not null,
+  succeeded bool not null,
+  error text null,
+  created_at timestamp(3) not null
+);
+
+CREATE INDEX index_webhook_deliveries_on_webhook_id ON webhook_deliveries(webhook_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
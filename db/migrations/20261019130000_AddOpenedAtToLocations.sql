@@ -0,0 +1,17 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE locations ADD COLUMN opened_at timestamp(3) null;
+
+-- Locations open before we tracked the transition are treated as opening when
+-- they were first seen.
+UPDATE locations SET opened_at = created_at WHERE open_soon = false;
+
+CREATE INDEX index_locations_on_opened_at ON locations(opened_at);
+CREATE INDEX index_locations_on_created_at ON locations(created_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX index_locations_on_created_at;
+DROP INDEX index_locations_on_opened_at;
+ALTER TABLE locations DROP COLUMN opened_at;
@@ -0,0 +1,10 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE INDEX index_locations_on_location_id ON locations(location_id);
+CREATE INDEX index_locations_on_path ON locations(path);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX index_locations_on_path;
+DROP INDEX index_locations_on_location_id;
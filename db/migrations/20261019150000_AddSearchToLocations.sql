@@ -0,0 +1,20 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- The simple configuration doesn't stem, names and addresses are in many
+-- languages. Names weigh the most, then the city and postal code.
+ALTER TABLE locations ADD COLUMN search tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+  setweight(to_tsvector('simple', coalesce(common_name, '')), 'A') ||
+  setweight(to_tsvector('simple', coalesce(city, '')), 'B') ||
+  setweight(to_tsvector('simple', coalesce(postal_code, '')), 'B') ||
+  setweight(to_tsvector('simple', coalesce(province_state, '')), 'C') ||
+  setweight(to_tsvector('simple', coalesce(address, '')), 'C')
+) STORED;
+
+CREATE INDEX index_locations_on_search ON locations USING GIN(search);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX index_locations_on_search;
+ALTER TABLE locations DROP COLUMN search;
@@ -0,0 +1,24 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE EXTENSION pg_trgm;
+CREATE EXTENSION unaccent;
+
+-- unaccent is only stable as its dictionary could change, indexes need an
+-- immutable function that names the dictionary.
+-- +goose StatementBegin
+CREATE FUNCTION immutable_unaccent(text) RETURNS text AS $$
+  SELECT public.unaccent('public.unaccent', $1)
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+-- +goose StatementEnd
+
+CREATE INDEX index_locations_on_title_trigram ON locations USING GIN(lower(immutable_unaccent(title)) gin_trgm_ops);
+CREATE INDEX index_locations_on_city_trigram ON locations USING GIN(lower(immutable_unaccent(city)) gin_trgm_ops);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX index_locations_on_city_trigram;
+DROP INDEX index_locations_on_title_trigram;
+DROP FUNCTION immutable_unaccent(text);
+DROP EXTENSION unaccent;
+DROP EXTENSION pg_trgm;
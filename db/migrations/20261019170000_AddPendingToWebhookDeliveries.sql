@@ -0,0 +1,16 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE webhook_deliveries
+  ADD COLUMN pending bool not null default false,
+  ADD COLUMN next_attempt_at timestamp(3) null;
+
+CREATE INDEX index_webhook_deliveries_on_next_attempt_at ON webhook_deliveries(next_attempt_at) WHERE pending;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX index_webhook_deliveries_on_next_attempt_at;
+
+ALTER TABLE webhook_deliveries
+  DROP COLUMN pending,
+  DROP COLUMN next_attempt_at;
@@ -1,13 +1,26 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/wattapp/superchargers/pkg/cache"
 	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/location"
 	"github.com/wattapp/superchargers/pkg/metrics"
+	"github.com/wattapp/superchargers/pkg/network"
+	"github.com/wattapp/superchargers/pkg/scheduler"
 	"github.com/wattapp/superchargers/pkg/web"
+	"github.com/wattapp/superchargers/pkg/webhook"
+	"golang.org/x/net/context"
 )
 
+// Heroku sends SIGKILL 30 seconds after SIGTERM
+const shutdownTimeout = 25 * time.Second
+
 func main() {
 	err := metrics.Connect()
 	if err != nil {
@@ -21,8 +34,66 @@ func main() {
 		panic(err)
 	}
 
-	err = web.Run()
+	location.OnSync(webhook.Enqueue)
+
+	queryCache, err := cache.NewFromEnv("locations")
+	if err != nil {
+		panic(err)
+	}
+
+	if queryCache != nil {
+		err = location.UseCache(queryCache)
+		if err != nil {
+			panic(err)
+		}
+		network.UseCache(queryCache)
+	}
+
+	syncScheduler, err := scheduler.NewSyncFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go shutdownOnSignal(cancel)
+
+	schedulerDone := make(chan struct{})
+	go func() {
+		if syncScheduler != nil {
+			syncScheduler.Run(ctx)
+		}
+		close(schedulerDone)
+	}()
+
+	dispatcherDone := make(chan struct{})
+	go func() {
+		webhook.DefaultDispatcher.Run(ctx)
+		close(dispatcherDone)
+	}()
+
+	err = web.Run(ctx)
 	if err != nil {
 		panic(err)
 	}
+
+	<-schedulerDone
+	<-dispatcherDone
+	fmt.Println("Shut down")
+}
+
+// shutdownOnSignal cancels ctx on SIGTERM or SIGINT, which stops the web
+// server once it has answered the requests in flight, cancels a sync in
+// progress and stops webhook deliveries once those being posted are done. It
+// exits non-zero when they haven't stopped in time.
+func shutdownOnSignal(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+
+	fmt.Println("Shutting down, waiting for requests, the scheduler and webhook deliveries to stop")
+	cancel()
+
+	time.Sleep(shutdownTimeout)
+	fmt.Println("Did not shut down in time")
+	os.Exit(1)
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/network"
+)
+
+var (
+	rangeKm = flag.Float64("range", 250, "How far apart, in km as the crow flies, two open Superchargers may be to be connected")
+	format  = flag.String("format", "text", "Report format, either text or json")
+)
+
+type report struct {
+	RangeKm    float64           `json:"range_km"`
+	Stations   int               `json:"stations"`
+	Components []reportComponent `json:"components"`
+}
+
+type reportComponent struct {
+	Size    int             `json:"size"`
+	Bridges []reportStation `json:"bridges"`
+}
+
+type reportStation struct {
+	ID      int64  `json:"id"`
+	Title   string `json:"title"`
+	Country string `json:"country"`
+}
+
+func main() {
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown format %q, expected text or json\n", *format)
+		os.Exit(2)
+	}
+
+	_, err := database.Connect()
+	if err != nil {
+		panic(err)
+	}
+
+	g, err := network.Load(*rangeKm)
+	if err != nil {
+		panic(err)
+	}
+
+	r := report{
+		RangeKm:    g.RangeKm,
+		Stations:   len(g.Stations),
+		Components: []reportComponent{},
+	}
+
+	for _, c := range g.Components() {
+		rc := reportComponent{Size: len(c.Stations), Bridges: []reportStation{}}
+		for _, s := range c.Bridges {
+			rc.Bridges = append(rc.Bridges, reportStation{ID: s.ID, Title: s.Title, Country: s.Country})
+		}
+		r.Components = append(r.Components, rc)
+	}
+
+	if *format == "json" {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("%s\n", b)
+		return
+	}
+
+	fmt.Printf("%d open Superchargers form %d components within %gkm\n", r.Stations, len(r.Components), r.RangeKm)
+	for i, c := range r.Components {
+		fmt.Printf("Component %d: %d Superchargers, %d bridges\n", i+1, c.Size, len(c.Bridges))
+		for _, s := range c.Bridges {
+			fmt.Printf("    id=%d %s (%s)\n", s.ID, s.Title, s.Country)
+		}
+	}
+}
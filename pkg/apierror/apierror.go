@@ -0,0 +1,33 @@
+// Package apierror has the errors that are safe to show to clients of the
+// API, each with a code clients may rely on not changing.
+package apierror
+
+const (
+	// BadUserInput is the code of errors in what was asked for, retrying
+	// won't help.
+	BadUserInput = "BAD_USER_INPUT"
+	// NotFound is the code of errors about objects that don't exist.
+	NotFound = "NOT_FOUND"
+	// Forbidden is the code of errors about fields needing an admin token.
+	Forbidden = "FORBIDDEN"
+)
+
+// Error is an error that's safe to show, along with its code.
+type Error struct {
+	message string
+	code    string
+}
+
+// New returns an error with the given code and message.
+func New(code string, message string) *Error {
+	return &Error{message: message, code: code}
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Code returns the code of the error.
+func (e *Error) Code() string {
+	return e.code
+}
@@ -0,0 +1,16 @@
+package apierror
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	var err error = New(NotFound, "Location not found")
+
+	assert.Equal(t, "Location not found", err.Error())
+	assert.Equal(t, NotFound, err.(interface {
+		Code() string
+	}).Code())
+}
@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"gopkg.in/mgutz/dat.v1/kvs"
+)
+
+const defaultTTL = time.Hour
+
+// Cache stores JSON encoded values in a kvs.KeyValueStore. Every key is
+// prefixed with a generation kept in the store, so Invalidate discards
+// everything at once without flushing a store that may be shared. A nil
+// *Cache loads every value.
+type Cache struct {
+	// Name prefixes keys and the cache.<name>.hit and .miss metrics.
+	Name  string
+	Store kvs.KeyValueStore
+	TTL   time.Duration
+}
+
+// New returns a cache of the given name in store.
+func New(name string, store kvs.KeyValueStore, ttl time.Duration) *Cache {
+	return &Cache{
+		Name:  name,
+		Store: store,
+		TTL:   ttl,
+	}
+}
+
+// NewFromEnv returns a cache of the given name in the store configured by
+// CACHE_STORE, either memory or redis using REDIS_URL. It's nil when
+// CACHE_STORE is unset. CACHE_TTL overrides the default TTL of an hour.
+func NewFromEnv(name string) (*Cache, error) {
+	ttl := defaultTTL
+	if s := os.Getenv("CACHE_TTL"); s != "" {
+		var err error
+		ttl, err = time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch kind := os.Getenv("CACHE_STORE"); kind {
+	case "":
+		return nil, nil
+	case "memory":
+		return New(name, kvs.NewMemoryKeyValueStore(time.Minute), ttl), nil
+	case "redis":
+		store, err := redisStore(os.Getenv("REDIS_URL"))
+		if err != nil {
+			return nil, err
+		}
+		return New(name, store, ttl), nil
+	default:
+		return nil, fmt.Errorf("Unknown CACHE_STORE %q, use memory or redis", kind)
+	}
+}
+
+func redisStore(rawurl string) (kvs.KeyValueStore, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	password := ""
+	if u.User != nil {
+		password, _ = u.User.Password()
+	}
+
+	return kvs.NewRedisStore("superchargers", u.Host, password)
+}
+
+// Key hashes the normalized description of a value into a key.
+func Key(parts ...string) string {
+	h := sha1.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Fetch decodes the cached value of key into dest. On a miss load fills dest,
+// which is then cached. A store that can't be reached is treated as a miss.
+func (c *Cache) Fetch(key string, dest interface{}, load func() error) error {
+	if c == nil {
+		return load()
+	}
+
+	generation, err := c.generation()
+	if err == nil {
+		key = c.Name + ":" + generation + ":" + key
+
+		var hit bool
+		hit, err = c.get(key, dest)
+		if err == nil && hit {
+			metrics.Incr("cache." + c.Name + ".hit")
+			return nil
+		}
+	}
+
+	if err != nil {
+		fmt.Printf("Unable to read cache %s: %v\n", c.Name, err)
+	}
+	metrics.Incr("cache." + c.Name + ".miss")
+
+	err = load()
+	if err != nil {
+		return err
+	}
+
+	if generation == "" {
+		return nil
+	}
+
+	err = c.set(key, dest)
+	if err != nil {
+		fmt.Printf("Unable to write cache %s: %v\n", c.Name, err)
+	}
+
+	return nil
+}
+
+// Set caches value under key, replacing any value cached there.
+func (c *Cache) Set(key string, value interface{}) error {
+	if c == nil {
+		return nil
+	}
+
+	generation, err := c.generation()
+	if err != nil {
+		return err
+	}
+
+	return c.set(c.Name+":"+generation+":"+key, value)
+}
+
+// Invalidate discards every cached value, leaving the old values to expire.
+func (c *Cache) Invalidate() error {
+	if c == nil {
+		return nil
+	}
+
+	metrics.Incr("cache." + c.Name + ".invalidate")
+
+	generation := strconv.FormatInt(time.Now().UnixNano(), 36)
+	return c.Store.Set(c.generationKey(), generation, kvs.TTLNever)
+}
+
+func (c *Cache) generationKey() string {
+	return c.Name + ":generation"
+}
+
+// generation returns the current prefix of keys, starting one when there is
+// none.
+func (c *Cache) generation() (string, error) {
+	generation, err := c.read(c.generationKey())
+	if err != nil {
+		return "", err
+	}
+
+	if generation == "" {
+		generation = "0"
+		err = c.Store.Set(c.generationKey(), generation, kvs.TTLNever)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return generation, nil
+}
+
+// read returns an empty value for missing keys, which the memory store does
+// but Redis reports as kvs.ErrNotFound.
+func (c *Cache) read(key string) (string, error) {
+	value, err := c.Store.Get(key)
+	if err == kvs.ErrNotFound {
+		return "", nil
+	}
+	return value, err
+}
+
+func (c *Cache) get(key string, dest interface{}) (bool, error) {
+	value, err := c.read(key)
+	if err != nil || value == "" {
+		return false, err
+	}
+
+	err = json.Unmarshal([]byte(value), dest)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *Cache) set(key string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return c.Store.Set(key, string(b), c.TTL)
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"gopkg.in/mgutz/dat.v1/kvs"
+)
+
+func init() {
+	metrics.Connect()
+}
+
+var errUnavailable = errors.New("Store unavailable")
+
+// fakeStore is an in-memory kvs.KeyValueStore that can be made to fail.
+type fakeStore struct {
+	values map[string]string
+	ttls   map[string]time.Duration
+	down   bool
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		values: map[string]string{},
+		ttls:   map[string]time.Duration{},
+	}
+}
+
+func (s *fakeStore) Set(key, value string, ttl time.Duration) error {
+	if s.down {
+		return errUnavailable
+	}
+	s.values[key] = value
+	s.ttls[key] = ttl
+	return nil
+}
+
+func (s *fakeStore) Get(key string) (string, error) {
+	if s.down {
+		return "", errUnavailable
+	}
+	value, ok := s.values[key]
+	if !ok {
+		return "", kvs.ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *fakeStore) Del(key string) error {
+	delete(s.values, key)
+	return nil
+}
+
+func (s *fakeStore) FlushDB() error {
+	s.values = map[string]string{}
+	return nil
+}
+
+type result struct {
+	Names []string
+}
+
+func fetch(c *Cache, loads *int) (result, error) {
+	r := result{}
+	err := c.Fetch("key", &r, func() error {
+		*loads++
+		r.Names = []string{"Barstow", "Hawthorne"}
+		return nil
+	})
+	return r, err
+}
+
+func TestFetchCachesLoadedValues(t *testing.T) {
+	store := newFakeStore()
+	c := New("locations", store, time.Hour)
+	loads := 0
+
+	r, err := fetch(c, &loads)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Barstow", "Hawthorne"}, r.Names)
+
+	r, err = fetch(c, &loads)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Barstow", "Hawthorne"}, r.Names)
+	assert.Equal(t, 1, loads)
+
+	assert.Equal(t, time.Hour, store.ttls["locations:0:key"])
+	assert.Equal(t, kvs.TTLNever, store.ttls["locations:generation"])
+}
+
+func TestInvalidateDiscardsCachedValues(t *testing.T) {
+	c := New("locations", newFakeStore(), time.Hour)
+	loads := 0
+
+	fetch(c, &loads)
+	assert.NoError(t, c.Invalidate())
+	fetch(c, &loads)
+	fetch(c, &loads)
+
+	assert.Equal(t, 2, loads)
+}
+
+func TestFetchLoadsWhenStoreIsDown(t *testing.T) {
+	store := newFakeStore()
+	store.down = true
+	c := New("locations", store, time.Hour)
+	loads := 0
+
+	r, err := fetch(c, &loads)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Barstow", "Hawthorne"}, r.Names)
+
+	fetch(c, &loads)
+	assert.Equal(t, 2, loads)
+}
+
+func TestFetchDoesNotCacheErrors(t *testing.T) {
+	c := New("locations", newFakeStore(), time.Hour)
+	loads := 0
+	fail := errors.New("Query failed")
+
+	r := result{}
+	err := c.Fetch("key", &r, func() error {
+		loads++
+		return fail
+	})
+	assert.Equal(t, fail, err)
+
+	fetch(c, &loads)
+	assert.Equal(t, 2, loads)
+}
+
+func TestSetReplacesCachedValues(t *testing.T) {
+	store := newFakeStore()
+	c := New("locations", store, time.Hour)
+	loads := 0
+
+	fetch(c, &loads)
+	assert.NoError(t, c.Set("key", result{Names: []string{"Fremont"}}))
+
+	r, err := fetch(c, &loads)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Fremont"}, r.Names)
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, time.Hour, store.ttls["locations:0:key"])
+
+	store.down = true
+	assert.Error(t, c.Set("key", result{}))
+
+	var nilCache *Cache
+	assert.NoError(t, nilCache.Set("key", result{}))
+}
+
+func TestNilCacheAlwaysLoads(t *testing.T) {
+	var c *Cache
+	loads := 0
+
+	fetch(c, &loads)
+	fetch(c, &loads)
+
+	assert.Equal(t, 2, loads)
+	assert.NoError(t, c.Invalidate())
+}
+
+func TestMemoryStore(t *testing.T) {
+	c := New("locations", kvs.NewMemoryKeyValueStore(time.Minute), time.Hour)
+	loads := 0
+
+	fetch(c, &loads)
+	r, err := fetch(c, &loads)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Barstow", "Hawthorne"}, r.Names)
+	assert.Equal(t, 1, loads)
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, Key("near", "a"), Key("near", "a"))
+	assert.NotEqual(t, Key("near", "a"), Key("locations", "a"))
+	assert.NotEqual(t, Key("ab", "c"), Key("a", "bc"))
+}
@@ -0,0 +1,155 @@
+// Package country is the catalog of the countries and regions Tesla operates
+// in, keyed by the names Tesla's feed uses.
+package country
+
+import (
+	"strings"
+
+	"github.com/wattapp/superchargers/pkg/apierror"
+)
+
+var ErrUnknownCode = apierror.New(apierror.BadUserInput, "Unknown ISO 3166-1 country code")
+
+// Region groups countries the way Tesla's feed does.
+type Region struct {
+	// Key is the region as Tesla's feed and the locations spell it.
+	Key  string
+	Name string
+}
+
+// Country is a country along with its ISO 3166-1 codes.
+type Country struct {
+	// Name is the country as Tesla's feed and the locations spell it.
+	Name   string
+	Alpha2 string
+	Alpha3 string
+	Region string
+	// Aliases are other spellings Tesla's feed has used for the country.
+	Aliases []string
+}
+
+var Regions = []Region{
+	{"north_america", "North America"},
+	{"europe", "Europe"},
+	{"asia_pacific", "Asia Pacific"},
+	{"middle_east", "Middle East"},
+}
+
+var Countries = []Country{
+	{Name: "Andorra", Alpha2: "AD", Alpha3: "AND", Region: "europe"},
+	{Name: "Australia", Alpha2: "AU", Alpha3: "AUS", Region: "asia_pacific"},
+	{Name: "Austria", Alpha2: "AT", Alpha3: "AUT", Region: "europe"},
+	{Name: "Belgium", Alpha2: "BE", Alpha3: "BEL", Region: "europe"},
+	{Name: "Bulgaria", Alpha2: "BG", Alpha3: "BGR", Region: "europe"},
+	{Name: "Canada", Alpha2: "CA", Alpha3: "CAN", Region: "north_america"},
+	{Name: "China", Alpha2: "CN", Alpha3: "CHN", Region: "asia_pacific"},
+	{Name: "Croatia", Alpha2: "HR", Alpha3: "HRV", Region: "europe"},
+	{Name: "Czech Republic", Alpha2: "CZ", Alpha3: "CZE", Region: "europe", Aliases: []string{"Czechia"}},
+	{Name: "Denmark", Alpha2: "DK", Alpha3: "DNK", Region: "europe"},
+	{Name: "Estonia", Alpha2: "EE", Alpha3: "EST", Region: "europe"},
+	{Name: "Finland", Alpha2: "FI", Alpha3: "FIN", Region: "europe"},
+	{Name: "France", Alpha2: "FR", Alpha3: "FRA", Region: "europe"},
+	{Name: "Germany", Alpha2: "DE", Alpha3: "DEU", Region: "europe"},
+	{Name: "Greece", Alpha2: "GR", Alpha3: "GRC", Region: "europe"},
+	{Name: "Hong Kong", Alpha2: "HK", Alpha3: "HKG", Region: "asia_pacific"},
+	{Name: "Hungary", Alpha2: "HU", Alpha3: "HUN", Region: "europe"},
+	{Name: "Iceland", Alpha2: "IS", Alpha3: "ISL", Region: "europe"},
+	{Name: "Ireland", Alpha2: "IE", Alpha3: "IRL", Region: "europe"},
+	{Name: "Israel", Alpha2: "IL", Alpha3: "ISR", Region: "middle_east"},
+	{Name: "Italy", Alpha2: "IT", Alpha3: "ITA", Region: "europe"},
+	{Name: "Japan", Alpha2: "JP", Alpha3: "JPN", Region: "asia_pacific"},
+	{Name: "Jordan", Alpha2: "JO", Alpha3: "JOR", Region: "middle_east"},
+	{Name: "Korea", Alpha2: "KR", Alpha3: "KOR", Region: "asia_pacific", Aliases: []string{"South Korea", "Republic of Korea"}},
+	{Name: "Latvia", Alpha2: "LV", Alpha3: "LVA", Region: "europe"},
+	{Name: "Liechtenstein", Alpha2: "LI", Alpha3: "LIE", Region: "europe"},
+	{Name: "Lithuania", Alpha2: "LT", Alpha3: "LTU", Region: "europe"},
+	{Name: "Luxembourg", Alpha2: "LU", Alpha3: "LUX", Region: "europe"},
+	{Name: "Macau", Alpha2: "MO", Alpha3: "MAC", Region: "asia_pacific", Aliases: []string{"Macao"}},
+	{Name: "Malaysia", Alpha2: "MY", Alpha3: "MYS", Region: "asia_pacific"},
+	{Name: "Mexico", Alpha2: "MX", Alpha3: "MEX", Region: "north_america"},
+	{Name: "Monaco", Alpha2: "MC", Alpha3: "MCO", Region: "europe"},
+	{Name: "Netherlands", Alpha2: "NL", Alpha3: "NLD", Region: "europe"},
+	{Name: "New Zealand", Alpha2: "NZ", Alpha3: "NZL", Region: "asia_pacific"},
+	{Name: "Norway", Alpha2: "NO", Alpha3: "NOR", Region: "europe"},
+	{Name: "Poland", Alpha2: "PL", Alpha3: "POL", Region: "europe"},
+	{Name: "Portugal", Alpha2: "PT", Alpha3: "PRT", Region: "europe"},
+	{Name: "Puerto Rico", Alpha2: "PR", Alpha3: "PRI", Region: "north_america"},
+	{Name: "Romania", Alpha2: "RO", Alpha3: "ROU", Region: "europe"},
+	{Name: "Serbia", Alpha2: "RS", Alpha3: "SRB", Region: "europe"},
+	{Name: "Singapore", Alpha2: "SG", Alpha3: "SGP", Region: "asia_pacific"},
+	{Name: "Slovakia", Alpha2: "SK", Alpha3: "SVK", Region: "europe"},
+	{Name: "Slovenia", Alpha2: "SI", Alpha3: "SVN", Region: "europe"},
+	{Name: "Spain", Alpha2: "ES", Alpha3: "ESP", Region: "europe"},
+	{Name: "Sweden", Alpha2: "SE", Alpha3: "SWE", Region: "europe"},
+	{Name: "Switzerland", Alpha2: "CH", Alpha3: "CHE", Region: "europe"},
+	{Name: "Taiwan", Alpha2: "TW", Alpha3: "TWN", Region: "asia_pacific"},
+	{Name: "Thailand", Alpha2: "TH", Alpha3: "THA", Region: "asia_pacific"},
+	{Name: "Turkey", Alpha2: "TR", Alpha3: "TUR", Region: "europe"},
+	{Name: "United Arab Emirates", Alpha2: "AE", Alpha3: "ARE", Region: "middle_east", Aliases: []string{"UAE"}},
+	{Name: "United Kingdom", Alpha2: "GB", Alpha3: "GBR", Region: "europe"},
+	{Name: "United States", Alpha2: "US", Alpha3: "USA", Region: "north_america"},
+}
+
+// ByName returns the country Tesla's feed calls name, by its name or one of
+// its aliases.
+func ByName(name string) (Country, bool) {
+	for _, c := range Countries {
+		if c.Name == name {
+			return c, true
+		}
+
+		for _, alias := range c.Aliases {
+			if alias == name {
+				return c, true
+			}
+		}
+	}
+
+	return Country{}, false
+}
+
+// ByCode returns the country with the ISO 3166-1 alpha-2 or alpha-3 code,
+// in any case.
+func ByCode(code string) (Country, bool) {
+	code = strings.ToUpper(code)
+	for _, c := range Countries {
+		if c.Alpha2 == code || c.Alpha3 == code {
+			return c, true
+		}
+	}
+
+	return Country{}, false
+}
+
+// Names returns the names of the countries with the ISO 3166-1 codes, or
+// ErrUnknownCode.
+func Names(codes []string) ([]string, error) {
+	names := []string{}
+	for _, code := range codes {
+		c, ok := ByCode(code)
+		if !ok {
+			return nil, ErrUnknownCode
+		}
+		names = append(names, c.Name)
+	}
+
+	return names, nil
+}
+
+// InRegion returns the countries of the region with the key.
+func InRegion(key string) []Country {
+	countries := []Country{}
+	for _, c := range Countries {
+		if c.Region == key {
+			countries = append(countries, c)
+		}
+	}
+
+	return countries
+}
+
+// EnumName is the name of a country or region as a GraphQL enum value, such
+// as UNITED_STATES or NORTH_AMERICA.
+func EnumName(name string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_").Replace(name))
+}
@@ -0,0 +1,52 @@
+package country
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByName(t *testing.T) {
+	c, ok := ByName("United States")
+	assert.True(t, ok)
+	assert.Equal(t, "US", c.Alpha2)
+
+	c, ok = ByName("South Korea")
+	assert.True(t, ok)
+	assert.Equal(t, "Korea", c.Name)
+
+	_, ok = ByName("Atlantis")
+	assert.False(t, ok)
+}
+
+func TestNames(t *testing.T) {
+	names, err := Names([]string{"us", "DEU"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"United States", "Germany"}, names)
+
+	_, err = Names([]string{"US", "XX"})
+	assert.Equal(t, ErrUnknownCode, err)
+}
+
+func TestCatalogIsConsistent(t *testing.T) {
+	regions := map[string]bool{}
+	for _, r := range Regions {
+		regions[r.Key] = true
+	}
+
+	codes := map[string]bool{}
+	for _, c := range Countries {
+		assert.True(t, regions[c.Region], c.Name)
+		assert.Len(t, c.Alpha2, 2, c.Name)
+		assert.Len(t, c.Alpha3, 3, c.Name)
+		assert.False(t, codes[c.Alpha2], c.Name)
+		assert.False(t, codes[c.Alpha3], c.Name)
+		codes[c.Alpha2] = true
+		codes[c.Alpha3] = true
+	}
+}
+
+func TestEnumName(t *testing.T) {
+	assert.Equal(t, "CZECH_REPUBLIC", EnumName("Czech Republic"))
+	assert.Equal(t, "NORTH_AMERICA", EnumName("north_america"))
+}
@@ -1,10 +1,12 @@
 package database
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/graphql-go/relay"
+	"github.com/wattapp/superchargers/pkg/apierror"
 	"gopkg.in/mgutz/dat.v1"
 )
 
@@ -12,8 +14,8 @@ const OrderOnCreatedAt = "created_at"
 
 var (
 	DefaultLimit                  = 50
-	ErrScopeInvalidBeforeAndAfter = errors.New("You cannot use before and after in the same query")
-	ErrScopeInvalidFirstAndLast   = errors.New("You cannot use first and last in the same query")
+	ErrScopeInvalidBeforeAndAfter = apierror.New(apierror.BadUserInput, "You cannot use before and after in the same query")
+	ErrScopeInvalidFirstAndLast   = apierror.New(apierror.BadUserInput, "You cannot use first and last in the same query")
 )
 
 type GraphQLCursor interface {
@@ -50,6 +52,51 @@ func NewGraphQLScopeWithFilters(args map[string]interface{}) GraphQLScope {
 	return scope
 }
 
+// Key identifies the results of the scope, scopes that only differ in the
+// order of enum lists like region or country share the same key.
+func (s GraphQLScope) Key() string {
+	args := map[string]interface{}{}
+	for name, value := range s.Args {
+		if value == nil {
+			continue
+		}
+
+		if list, ok := value.([]interface{}); ok {
+			value = sortedStrings(list)
+		}
+		args[name] = value
+	}
+
+	key, _ := json.Marshal(struct {
+		Args    map[string]interface{}
+		Limit   int
+		Order   string
+		OrderBy string
+	}{args, s.Limit, s.Order, s.OrderBy})
+
+	return string(key)
+}
+
+// sortedStrings sorts a copy of lists made only of strings, any other list
+// is returned untouched as its order is meaningful.
+func sortedStrings(list []interface{}) []interface{} {
+	strs := []string{}
+	for _, v := range list {
+		str, ok := v.(string)
+		if !ok {
+			return list
+		}
+		strs = append(strs, str)
+	}
+	sort.Strings(strs)
+
+	sorted := []interface{}{}
+	for _, str := range strs {
+		sorted = append(sorted, str)
+	}
+	return sorted
+}
+
 func ApplyGraphQLScope(builder *dat.SelectBuilder, scope GraphQLScope) (*dat.SelectBuilder, error) {
 	// Strongly discouraged from using both
 	if scope.Before != "" && scope.After != "" {
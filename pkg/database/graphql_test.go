@@ -0,0 +1,39 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeKeyIgnoresEnumOrder(t *testing.T) {
+	a := NewGraphQLScopeWithFilters(map[string]interface{}{
+		"region":  []interface{}{"europe", "north_america"},
+		"country": nil,
+	})
+	b := NewGraphQLScopeWithFilters(map[string]interface{}{
+		"region": []interface{}{"north_america", "europe"},
+	})
+
+	assert.Equal(t, a.Key(), b.Key())
+	assert.Equal(t, []interface{}{"europe", "north_america"}, a.Args["region"])
+}
+
+func TestScopeKeyKeepsBoundingBoxOrder(t *testing.T) {
+	a := NewGraphQLScopeWithFilters(map[string]interface{}{
+		"boundingBox": []interface{}{42.0, -76.4, 38.8, -83.4},
+	})
+	b := NewGraphQLScopeWithFilters(map[string]interface{}{
+		"boundingBox": []interface{}{38.8, -83.4, 42.0, -76.4},
+	})
+
+	assert.NotEqual(t, a.Key(), b.Key())
+}
+
+func TestScopeKeyIncludesLimit(t *testing.T) {
+	a := NewGraphQLScopeWithFilters(map[string]interface{}{"first": 10})
+	b := NewGraphQLScopeWithFilters(map[string]interface{}{"first": 10})
+	b.Limit = -1
+
+	assert.NotEqual(t, a.Key(), b.Key())
+}
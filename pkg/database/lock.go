@@ -0,0 +1,20 @@
+package database
+
+// WithAdvisoryLock runs fn while holding the Postgres advisory lock for key.
+// The lock is scoped to a transaction so it is released with the pooled
+// connection even if the process dies. When another session holds the lock fn
+// isn't run and ok is false.
+func WithAdvisoryLock(key int64, fn func() error) (ok bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.AutoRollback()
+
+	err = tx.SQL("SELECT pg_try_advisory_xact_lock($1)", key).QueryScalar(&ok)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, fn()
+}
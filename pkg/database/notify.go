@@ -0,0 +1,160 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+// maxNotifyPayload is just under the 8000 byte limit Postgres puts on
+// notification payloads.
+const maxNotifyPayload = 7999
+
+var ErrNotifyPayloadTooLarge = errors.New("Notification payload exceeds 8000 bytes")
+
+// changedIDsPerNotification keeps a batch of IDs within maxNotifyPayload,
+// even with 19 digit IDs.
+const changedIDsPerNotification = 350
+
+// NotifyHandler receives the payload of each notification on a channel.
+type NotifyHandler func(payload string)
+
+// ChangeHandler receives the IDs of rows that changed, nil means any row may
+// have changed and everything derived from them should be discarded.
+type ChangeHandler func(ids []int64)
+
+var notifications = struct {
+	sync.Mutex
+	listener  *pq.Listener
+	handlers  map[string][]NotifyHandler
+	reconnect []func()
+}{
+	handlers: map[string][]NotifyHandler{},
+}
+
+// Notify sends the payload to every process listening on the channel. When
+// conn is a transaction it's only delivered once the transaction commits.
+func Notify(conn runner.Connection, channel string, payload string) error {
+	if len(payload) > maxNotifyPayload {
+		return ErrNotifyPayloadTooLarge
+	}
+
+	_, err := conn.SQL("SELECT pg_notify($1, $2)", channel, payload).Exec()
+	return err
+}
+
+// Listen calls handler with every notification sent on the channel from any
+// process. The first call opens a dedicated connection to DATABASE_URL which
+// reconnects on its own, notifications sent while it is disconnected are
+// lost.
+func Listen(channel string, handler NotifyHandler) error {
+	notifications.Lock()
+	defer notifications.Unlock()
+
+	if notifications.listener == nil {
+		notifications.listener = pq.NewListener(os.Getenv("DATABASE_URL"), time.Second, time.Minute, logListenerEvent)
+		go dispatchNotifications(notifications.listener)
+	}
+
+	_, listening := notifications.handlers[channel]
+	notifications.handlers[channel] = append(notifications.handlers[channel], handler)
+	if listening {
+		return nil
+	}
+
+	return notifications.listener.Listen(channel)
+}
+
+// PublishChanges notifies every process subscribed to the channel with
+// SubscribeChanges that the rows with the given IDs changed.
+func PublishChanges(conn runner.Connection, channel string, ids []int64) error {
+	for start := 0; start < len(ids); start += changedIDsPerNotification {
+		end := start + changedIDsPerNotification
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		payload, err := json.Marshal(ids[start:end])
+		if err != nil {
+			return err
+		}
+
+		err = Notify(conn, channel, string(payload))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SubscribeChanges calls handler with the IDs published on the channel with
+// PublishChanges. Changes published while the notification connection was
+// down are lost, so handler is called with nil once it reconnects.
+func SubscribeChanges(channel string, handler ChangeHandler) error {
+	notifications.Lock()
+	notifications.reconnect = append(notifications.reconnect, func() {
+		handler(nil)
+	})
+	notifications.Unlock()
+
+	return Listen(channel, func(payload string) {
+		ids := []int64{}
+		err := json.Unmarshal([]byte(payload), &ids)
+		if err != nil {
+			fmt.Printf("Unable to decode changes on %s: %v\n", channel, err)
+			handler(nil)
+			return
+		}
+
+		handler(ids)
+	})
+}
+
+func dispatchNotifications(listener *pq.Listener) {
+	for {
+		select {
+		case n := <-listener.Notify:
+			// A nil notification follows a reconnect, anything sent while
+			// disconnected was missed.
+			if n == nil {
+				notifications.Lock()
+				reconnect := notifications.reconnect
+				notifications.Unlock()
+
+				for _, fn := range reconnect {
+					fn()
+				}
+				continue
+			}
+
+			notifications.Lock()
+			handlers := notifications.handlers[n.Channel]
+			notifications.Unlock()
+
+			for _, handler := range handlers {
+				handler(n.Extra)
+			}
+		case <-time.After(90 * time.Second):
+			// Detect a dead connection that hasn't been noticed yet
+			go listener.Ping()
+		}
+	}
+}
+
+func logListenerEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		fmt.Printf("Lost the notification connection: %v\n", err)
+	case pq.ListenerEventReconnected:
+		fmt.Println("Reconnected the notification connection")
+	case pq.ListenerEventConnectionAttemptFailed:
+		fmt.Printf("Unable to connect for notifications: %v\n", err)
+	}
+}
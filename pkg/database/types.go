@@ -0,0 +1,46 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// StringList is a list of strings stored in a jsonb column.
+type StringList []string
+
+func (sl StringList) Value() (driver.Value, error) {
+	if sl == nil {
+		sl = StringList{}
+	}
+
+	bytes, err := json.Marshal(sl)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+func (sl *StringList) Scan(src interface{}) error {
+	asBytes, ok := src.([]byte)
+	if !ok {
+		return errors.New("Scan source was not []bytes")
+	}
+
+	err := json.Unmarshal(asBytes, &sl)
+	if err != nil {
+		return errors.New("Scan could not unmarshal to []string")
+	}
+
+	return nil
+}
+
+// Includes reports whether the list contains s.
+func (sl StringList) Includes(s string) bool {
+	for _, v := range sl {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
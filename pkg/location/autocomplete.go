@@ -0,0 +1,123 @@
+package location
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dewski/spatial"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/database"
+)
+
+const (
+	// DefaultSuggestions and MaxSuggestions are how many suggestions
+	// Autocomplete returns by default and at most.
+	DefaultSuggestions = 10
+	MaxSuggestions     = 50
+	// minPrefixLength is the shortest prefix with enough trigrams to match.
+	minPrefixLength = 2
+	// nearBoost is added to the score of a suggestion at the coordinate it's
+	// near, halving every nearBoostKm further away.
+	nearBoost   = 0.5
+	nearBoostKm = 100.0
+)
+
+// Suggestion is a location whose title or city is like a prefix, Text is
+// whichever of them is the most alike. Score is how alike they are between
+// 0 and 1, boosted when the location is near the coordinate asked for.
+type Suggestion struct {
+	Location *Location
+	Text     string
+	Score    float64
+}
+
+type suggestionRow struct {
+	Location
+	TitleSimilarity float64 `db:"title_similarity"`
+	CitySimilarity  float64 `db:"city_similarity"`
+	Text            string  `db:"text"`
+	Score           float64 `db:"score"`
+}
+
+// Autocomplete suggests up to limit locations whose title or city is like
+// what's been typed so far, tolerating misspellings and ignoring accents
+// and case. Suggestions nearer to near, when given, rank higher. It's
+// cached when UseCache is configured.
+func Autocomplete(prefix string, near *spatial.Point, limit int) ([]Suggestion, error) {
+	prefix = strings.TrimSpace(prefix)
+	suggestions := []Suggestion{}
+	if utf8.RuneCountInString(prefix) < minPrefixLength {
+		return suggestions, nil
+	}
+
+	limit = suggestionLimit(limit)
+
+	var lat, lng *float64
+	if near != nil {
+		if near.Lat < -90 || near.Lat > 90 {
+			return nil, ErrInvalidLatitude
+		}
+
+		if near.Lng < -180 || near.Lng > 180 {
+			return nil, ErrInvalidLongitude
+		}
+
+		lat, lng = &near.Lat, &near.Lng
+	}
+
+	key := cache.Key("autocomplete", prefix, fmt.Sprint(near), fmt.Sprint(limit))
+	err := queryCache.Fetch(key, &suggestions, func() error {
+		// <% matches when the prefix is like a word of the title or city,
+		// which the trigram indexes on the normalized columns answer
+		rows := []suggestionRow{}
+		err := database.Conn().SQL(`
+			SELECT *,
+				CASE WHEN title_similarity >= city_similarity THEN title ELSE city END AS text,
+				GREATEST(title_similarity, city_similarity) + CASE
+					WHEN $2::float8 IS NULL THEN 0
+					ELSE $5 * power(0.5, ST_Distance(geo::geography, ST_SetSRID(ST_MakePoint($3, $2), 4326)::geography) / 1000 / $6)
+				END AS score
+			FROM (
+				SELECT `+prefixColumns("locations", selectColumns)+`,
+					word_similarity(q, lower(immutable_unaccent(title))) AS title_similarity,
+					word_similarity(q, lower(immutable_unaccent(city))) AS city_similarity
+				FROM locations, lower(immutable_unaccent($1)) AS q
+				WHERE q <% lower(immutable_unaccent(title)) OR q <% lower(immutable_unaccent(city))
+			) matches
+			ORDER BY score DESC, id
+			LIMIT $4
+		`, prefix, lat, lng, limit, nearBoost, nearBoostKm).QueryStructs(&rows)
+		if err != nil {
+			return err
+		}
+
+		for i := range rows {
+			suggestions = append(suggestions, Suggestion{
+				Location: &rows[i].Location,
+				Text:     rows[i].Text,
+				Score:    rows[i].Score,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// suggestionLimit is limit up to MaxSuggestions, or DefaultSuggestions when
+// it isn't positive.
+func suggestionLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return DefaultSuggestions
+	case limit > MaxSuggestions:
+		return MaxSuggestions
+	}
+
+	return limit
+}
@@ -0,0 +1,32 @@
+package location
+
+import (
+	"testing"
+
+	"github.com/dewski/spatial"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutocompleteNeedsAPrefix(t *testing.T) {
+	for _, prefix := range []string{"", " ", "M", " ü "} {
+		suggestions, err := Autocomplete(prefix, nil, 10)
+		assert.Nil(t, err)
+		assert.Empty(t, suggestions)
+	}
+}
+
+func TestAutocompleteValidatesNear(t *testing.T) {
+	_, err := Autocomplete("Barstw", &spatial.Point{Lat: 91, Lng: 0}, 10)
+	assert.Equal(t, ErrInvalidLatitude, err)
+
+	_, err = Autocomplete("Barstw", &spatial.Point{Lat: 35, Lng: -181}, 10)
+	assert.Equal(t, ErrInvalidLongitude, err)
+}
+
+func TestSuggestionLimit(t *testing.T) {
+	assert.Equal(t, DefaultSuggestions, suggestionLimit(0))
+	assert.Equal(t, DefaultSuggestions, suggestionLimit(-5))
+	assert.Equal(t, 25, suggestionLimit(25))
+	assert.Equal(t, MaxSuggestions, suggestionLimit(MaxSuggestions))
+	assert.Equal(t, MaxSuggestions, suggestionLimit(1000))
+}
@@ -0,0 +1,90 @@
+package location
+
+import (
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+// History is when each location was first seen, and first seen open, in
+// archived copies of Tesla's feed. It reaches further back than the
+// locations, which only know when our syncs first saw them.
+type History struct {
+	FirstSeen   map[int64]time.Time
+	FirstOpened map[int64]time.Time
+}
+
+func NewHistory() *History {
+	return &History{
+		FirstSeen:   map[int64]time.Time{},
+		FirstOpened: map[int64]time.Time{},
+	}
+}
+
+// Add records the superchargers of a snapshot of the feed taken at seenAt,
+// snapshots may be added in any order.
+func (h *History) Add(seenAt time.Time, superchargers []supercharger.Supercharger) {
+	seenAt = seenAt.UTC()
+	for _, s := range superchargers {
+		if first, ok := h.FirstSeen[s.Nid]; !ok || seenAt.Before(first) {
+			h.FirstSeen[s.Nid] = seenAt
+		}
+
+		if s.OpenSoon {
+			continue
+		}
+
+		if first, ok := h.FirstOpened[s.Nid]; !ok || seenAt.Before(first) {
+			h.FirstOpened[s.Nid] = seenAt
+		}
+	}
+}
+
+// Backfill moves created_at and opened_at of the locations back to when
+// history first saw them and first saw them open, it never moves them
+// forward. Locations that are opening soon again keep no opened_at. It
+// returns the IDs of the locations that changed, which are published to
+// those registered with OnChange.
+func Backfill(h *History) ([]int64, error) {
+	tx, err := database.Conn().Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.AutoRollback()
+
+	ids := []int64{}
+	for nid, seenAt := range h.FirstSeen {
+		var openedAt *time.Time
+		if opened, ok := h.FirstOpened[nid]; ok {
+			openedAt = &opened
+		}
+
+		changed := []int64{}
+		err = tx.SQL(`
+			UPDATE locations SET
+				created_at = LEAST(created_at, $2),
+				opened_at = CASE WHEN open_soon OR $3::timestamp IS NULL THEN opened_at ELSE LEAST(opened_at, $3) END
+			WHERE nid = $1
+				AND (created_at > $2 OR (NOT open_soon AND $3::timestamp IS NOT NULL AND (opened_at IS NULL OR opened_at > $3)))
+			RETURNING id
+		`, nid, seenAt, openedAt).QuerySlice(&changed)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, changed...)
+	}
+
+	err = database.PublishChanges(tx, ChangedChannel, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
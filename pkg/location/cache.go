@@ -0,0 +1,24 @@
+package location
+
+import (
+	"fmt"
+
+	"github.com/wattapp/superchargers/pkg/cache"
+)
+
+// queryCache holds the results of GetLocation, Near and Locations, nil
+// disables caching.
+var queryCache *cache.Cache
+
+// UseCache caches queries for locations in c until the locations change in
+// any process.
+func UseCache(c *cache.Cache) error {
+	queryCache = c
+
+	return OnChange(func(ids []int64) {
+		err := c.Invalidate()
+		if err != nil {
+			fmt.Printf("Unable to invalidate cache %s: %v\n", c.Name, err)
+		}
+	})
+}
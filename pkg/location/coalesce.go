@@ -0,0 +1,63 @@
+package location
+
+import (
+	"sync"
+
+	"github.com/wattapp/superchargers/pkg/metrics"
+)
+
+// flight is a query in progress, its result is shared with every identical
+// query made before it finishes.
+type flight struct {
+	wg        sync.WaitGroup
+	locations []*Location
+	err       error
+}
+
+// flightGroup coalesces identical concurrent queries into a single database
+// round trip.
+type flightGroup struct {
+	sync.Mutex
+	flights map[string]*flight
+}
+
+var inflight = newFlightGroup()
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{
+		flights: map[string]*flight{},
+	}
+}
+
+// do calls load unless a query with the same key is already running, in which
+// case it waits for and returns that query's result. Coalesced calls are
+// counted as <name>.coalesced. Callers share the returned locations and must
+// not modify them.
+func (g *flightGroup) do(name string, key string, load func() ([]*Location, error)) ([]*Location, error) {
+	key = name + ":" + key
+
+	g.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.Unlock()
+
+		metrics.Incr(name + ".coalesced")
+		f.wg.Wait()
+		return f.locations, f.err
+	}
+
+	f := &flight{}
+	f.wg.Add(1)
+	g.flights[key] = f
+	g.Unlock()
+
+	defer func() {
+		g.Lock()
+		delete(g.flights, key)
+		g.Unlock()
+
+		f.wg.Done()
+	}()
+
+	f.locations, f.err = load()
+	return f.locations, f.err
+}
@@ -0,0 +1,96 @@
+package location
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/metrics"
+)
+
+func init() {
+	metrics.Connect()
+}
+
+func TestFlightGroupCoalescesConcurrentCalls(t *testing.T) {
+	g := newFlightGroup()
+	calling := make(chan struct{}, 10)
+
+	var mu sync.Mutex
+	loads := 0
+
+	// The load blocks until every caller is about to call do, and a moment
+	// more so they join its flight
+	load := func() ([]*Location, error) {
+		mu.Lock()
+		loads++
+		first := loads == 1
+		mu.Unlock()
+
+		// Calls that missed the flight fail the test rather than hang it
+		if first {
+			for i := 0; i < cap(calling); i++ {
+				<-calling
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		return []*Location{{ID: 1}}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]*Location, cap(calling))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			calling <- struct{}{}
+			results[i], _ = g.do("locations", "scope", load)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, loads)
+	for _, locations := range results {
+		assert.Len(t, locations, 1)
+		assert.Equal(t, int64(1), locations[0].ID)
+	}
+
+	// The finished flight isn't reused
+	_, err := g.do("locations", "scope", func() ([]*Location, error) {
+		return nil, errors.New("Failed")
+	})
+	assert.EqualError(t, err, "Failed")
+	assert.Empty(t, g.flights)
+}
+
+func TestFlightGroupSeparatesKeys(t *testing.T) {
+	g := newFlightGroup()
+	release := make(chan struct{})
+	started := make(chan string, 2)
+
+	load := func(key string) func() ([]*Location, error) {
+		return func() ([]*Location, error) {
+			started <- key
+			<-release
+			return nil, nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			g.do("near", key, load(key))
+		}(key)
+	}
+
+	// Both loads start even though neither has finished
+	<-started
+	<-started
+	close(release)
+	wg.Wait()
+}
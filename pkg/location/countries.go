@@ -0,0 +1,101 @@
+package location
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/country"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+// UnmappedCountriesError is returned when the feed has countries missing
+// from the catalog in pkg/country, as their locations couldn't be filtered
+// on. Nothing is synced until they're added.
+type UnmappedCountriesError struct {
+	Countries []string
+}
+
+func (e *UnmappedCountriesError) Error() string {
+	return fmt.Sprintf("Countries missing from the catalog: %s", strings.Join(e.Countries, ", "))
+}
+
+// normalizeCountries spells the country of each supercharger as the catalog
+// does, or returns an *UnmappedCountriesError. Countries the feed places in
+// another region than the catalog are only logged and counted, regions are
+// filtered on as the feed has them.
+func normalizeCountries(superchargers []supercharger.Supercharger) ([]supercharger.Supercharger, error) {
+	unmapped := map[string]bool{}
+	mismatched := map[string]bool{}
+	normalized := make([]supercharger.Supercharger, len(superchargers))
+	for i, s := range superchargers {
+		c, ok := country.ByName(s.Country)
+		if !ok {
+			unmapped[s.Country] = true
+		} else if s.Region != c.Region {
+			mismatched[fmt.Sprintf("%s (%s)", c.Name, s.Region)] = true
+		}
+
+		s.Country = c.Name
+		normalized[i] = s
+	}
+
+	if len(unmapped) > 0 {
+		return nil, &UnmappedCountriesError{Countries: sortedKeys(unmapped)}
+	}
+
+	if len(mismatched) > 0 {
+		fmt.Printf("Regions not matching the catalog: %s\n", strings.Join(sortedKeys(mismatched), ", "))
+		for range mismatched {
+			metrics.Incr("sync.region_mismatch")
+		}
+	}
+
+	return normalized, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// locationCount is the number of locations of a country or region.
+type locationCount struct {
+	Key   string `db:"key"`
+	Count int    `db:"count"`
+}
+
+// CountByCountry returns the number of locations in each country, cached
+// when UseCache is configured.
+func CountByCountry() (map[string]int, error) {
+	return countBy("country")
+}
+
+func countBy(column string) (map[string]int, error) {
+	counts := []locationCount{}
+	err := queryCache.Fetch(cache.Key("count", column), &counts, func() error {
+		return database.Conn().
+			Select(column+" AS key", "COUNT(*) AS count").
+			From("locations").
+			GroupBy(column).
+			QueryStructs(&counts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]int{}
+	for _, c := range counts {
+		byKey[c.Key] = c.Count
+	}
+
+	return byKey, nil
+}
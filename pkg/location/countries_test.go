@@ -0,0 +1,45 @@
+package location
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+func TestNormalizeCountries(t *testing.T) {
+	superchargers := []supercharger.Supercharger{
+		{Nid: 1, Country: "South Korea", Region: "asia_pacific"},
+		{Nid: 2, Country: "Germany", Region: "europe"},
+	}
+
+	normalized, err := normalizeCountries(superchargers)
+	assert.NoError(t, err)
+	assert.Equal(t, "Korea", normalized[0].Country)
+	assert.Equal(t, "Germany", normalized[1].Country)
+	assert.Equal(t, "South Korea", superchargers[0].Country)
+
+	superchargers = append(superchargers,
+		supercharger.Supercharger{Nid: 3, Country: "Atlantis", Region: "europe"},
+		supercharger.Supercharger{Nid: 4, Country: "Agartha"},
+		supercharger.Supercharger{Nid: 5, Country: "Atlantis"},
+	)
+	_, err = normalizeCountries(superchargers)
+	assert.Equal(t, &UnmappedCountriesError{Countries: []string{"Agartha", "Atlantis"}}, err)
+	assert.EqualError(t, err, "Countries missing from the catalog: Agartha, Atlantis")
+}
+
+func TestNormalizeCountriesKeepsFeedRegions(t *testing.T) {
+	// Tesla regrouping countries doesn't block syncs
+	superchargers := []supercharger.Supercharger{
+		{Nid: 1, Country: "Germany", Region: "europe"},
+		{Nid: 2, Country: "South Korea", Region: "europe"},
+		{Nid: 3, Country: "Mexico", Region: "latin_america"},
+	}
+
+	normalized, err := normalizeCountries(superchargers)
+	assert.NoError(t, err)
+	assert.Equal(t, "Korea", normalized[1].Country)
+	assert.Equal(t, "europe", normalized[1].Region)
+	assert.Equal(t, "latin_america", normalized[2].Region)
+}
@@ -0,0 +1,172 @@
+package location
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/dewski/spatial"
+	"github.com/lib/pq"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/database"
+)
+
+const (
+	// maxCoverageCells is the most cells a grid may sample.
+	maxCoverageCells = 2500
+	// maxAreaPoints is the most points of a polygon, each cell is tested
+	// against every edge.
+	maxAreaPoints = 200
+	// minGridKm is the closest cells may be.
+	minGridKm = 1
+	// kmPerDegree is the length of a degree of latitude, and of longitude
+	// at the equator.
+	kmPerDegree = 111.32
+	// nearestCandidates are found by KNN on geo, which measures degrees,
+	// before picking the one nearest on the ground.
+	nearestCandidates = 8
+)
+
+var (
+	ErrInvalidArea     = apierror.New(apierror.BadUserInput, "Provide a bounding box of 4 coordinates or a polygon of 3 to 200 points")
+	ErrInvalidDistance = apierror.New(apierror.BadUserInput, "maxDistanceKm must be positive and gridKm at least 1")
+	ErrTooManyCells    = apierror.New(apierror.BadUserInput, "The grid has more than 2500 cells, use a larger gridKm or a smaller area")
+)
+
+// CoverageGap is a cell of the grid whose nearest open Supercharger is
+// further than allowed. NearestID and DistanceKm are nil when there's no
+// open Supercharger at all.
+type CoverageGap struct {
+	Latitude   float64  `db:"latitude"`
+	Longitude  float64  `db:"longitude"`
+	NearestID  *int64   `db:"nearest_id"`
+	DistanceKm *float64 `db:"distance_km"`
+}
+
+// BoundingBox is the polygon of the box between its north west and south
+// east corners.
+func BoundingBox(nw, se spatial.Point) []spatial.Point {
+	return []spatial.Point{
+		nw,
+		{Lat: nw.Lat, Lng: se.Lng},
+		se,
+		{Lat: se.Lat, Lng: nw.Lng},
+	}
+}
+
+// CoverageGaps samples the area with a grid of cells gridKm apart and
+// returns those further than maxDistanceKm from the nearest open
+// Supercharger, the furthest first. It's cached when UseCache is configured.
+func CoverageGaps(area []spatial.Point, maxDistanceKm, gridKm float64) ([]CoverageGap, error) {
+	if len(area) < 3 || len(area) > maxAreaPoints {
+		return nil, ErrInvalidArea
+	}
+
+	for _, p := range area {
+		err := CheckPoint(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if maxDistanceKm <= 0 || gridKm < minGridKm {
+		return nil, ErrInvalidDistance
+	}
+
+	cells, err := coverageGrid(area, gridKm)
+	if err != nil {
+		return nil, err
+	}
+
+	lats, lngs := []float64{}, []float64{}
+	for _, c := range cells {
+		lats = append(lats, c.Lat)
+		lngs = append(lngs, c.Lng)
+	}
+
+	gaps := []CoverageGap{}
+	key := cache.Key("coverage", fmt.Sprint(area), fmt.Sprint(maxDistanceKm), fmt.Sprint(gridKm))
+	err = queryCache.Fetch(key, &gaps, func() error {
+		return database.Conn().SQL(fmt.Sprintf(`
+			SELECT c.lat AS latitude, c.lng AS longitude, n.id AS nearest_id, n.distance_km
+			FROM unnest($1::float8[], $2::float8[]) AS c(lat, lng)
+			LEFT JOIN LATERAL (
+				SELECT id, ST_Distance(geo::geography, ST_SetSRID(ST_MakePoint(c.lng, c.lat), 4326)::geography) / 1000 AS distance_km
+				FROM (
+					SELECT id, geo FROM locations
+					WHERE NOT open_soon AND location_type @> '["supercharger"]'
+					ORDER BY geo <-> ST_SetSRID(ST_MakePoint(c.lng, c.lat), 4326)
+					LIMIT %d
+				) candidates
+				ORDER BY distance_km
+				LIMIT 1
+			) n ON true
+			WHERE n.id IS NULL OR n.distance_km > $3
+			ORDER BY n.distance_km DESC NULLS FIRST, c.lat DESC, c.lng
+		`, nearestCandidates), pq.Array(lats), pq.Array(lngs), maxDistanceKm).QueryStructs(&gaps)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return gaps, nil
+}
+
+// coverageGrid returns the centers of the cells gridKm apart within the
+// area. Cells in a row are gridKm apart on the ground, so rows nearer the
+// poles have fewer of them. Grids whose bounding box would have more than
+// maxCoverageCells cells are rejected before sampling any.
+func coverageGrid(area []spatial.Point, gridKm float64) ([]spatial.Point, error) {
+	minLat, maxLat := area[0].Lat, area[0].Lat
+	minLng, maxLng := area[0].Lng, area[0].Lng
+	for _, p := range area[1:] {
+		minLat, maxLat = math.Min(minLat, p.Lat), math.Max(maxLat, p.Lat)
+		minLng, maxLng = math.Min(minLng, p.Lng), math.Max(maxLng, p.Lng)
+	}
+
+	// The row nearest the equator has the most cells
+	nearestEquator := math.Min(math.Abs(minLat), math.Abs(maxLat))
+	if minLat < 0 && maxLat > 0 {
+		nearestEquator = 0
+	}
+
+	latStep := gridKm / kmPerDegree
+	rows := math.Ceil((maxLat - minLat) / latStep)
+	cols := math.Ceil((maxLng - minLng) / lngStep(nearestEquator, gridKm))
+	if rows > maxCoverageCells || cols > maxCoverageCells || rows*cols > maxCoverageCells {
+		return nil, ErrTooManyCells
+	}
+
+	cells := []spatial.Point{}
+	for lat := minLat + latStep/2; lat < maxLat; lat += latStep {
+		step := lngStep(lat, gridKm)
+		for lng := minLng + step/2; lng < maxLng; lng += step {
+			cell := spatial.Point{Lat: lat, Lng: lng}
+			if insidePolygon(cell, area) {
+				cells = append(cells, cell)
+			}
+		}
+	}
+
+	return cells, nil
+}
+
+// lngStep is the degrees of longitude gridKm apart at the latitude.
+func lngStep(lat, gridKm float64) float64 {
+	return gridKm / (kmPerDegree * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+}
+
+// insidePolygon reports whether p is inside the polygon by casting a ray
+// along its latitude and counting the edges it crosses.
+func insidePolygon(p spatial.Point, polygon []spatial.Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
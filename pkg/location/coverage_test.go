@@ -0,0 +1,97 @@
+package location
+
+import (
+	"testing"
+
+	"github.com/dewski/spatial"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsidePolygon(t *testing.T) {
+	square := BoundingBox(spatial.Point{Lat: 10, Lng: 0}, spatial.Point{Lat: 0, Lng: 10})
+	assert.True(t, insidePolygon(spatial.Point{Lat: 5, Lng: 5}, square))
+	assert.False(t, insidePolygon(spatial.Point{Lat: 5, Lng: 11}, square))
+	assert.False(t, insidePolygon(spatial.Point{Lat: -1, Lng: 5}, square))
+
+	// A U open to the north, its notch isn't inside
+	u := []spatial.Point{
+		{Lat: 0, Lng: 0}, {Lat: 10, Lng: 0}, {Lat: 10, Lng: 3}, {Lat: 3, Lng: 3},
+		{Lat: 3, Lng: 7}, {Lat: 10, Lng: 7}, {Lat: 10, Lng: 10}, {Lat: 0, Lng: 10},
+	}
+	assert.True(t, insidePolygon(spatial.Point{Lat: 8, Lng: 1}, u))
+	assert.True(t, insidePolygon(spatial.Point{Lat: 1, Lng: 5}, u))
+	assert.False(t, insidePolygon(spatial.Point{Lat: 8, Lng: 5}, u))
+}
+
+func TestCoverageGrid(t *testing.T) {
+	// About 2 by 2 cells of 50km at the equator
+	area := BoundingBox(spatial.Point{Lat: 0.9, Lng: 0}, spatial.Point{Lat: 0, Lng: 0.9})
+	cells, err := coverageGrid(area, 50)
+	assert.Nil(t, err)
+	assert.Len(t, cells, 4)
+	assert.InDelta(t, 50/kmPerDegree, cells[1].Lng-cells[0].Lng, 0.001)
+
+	for _, c := range cells {
+		assert.True(t, insidePolygon(c, area))
+	}
+}
+
+func TestCoverageGridTooManyCells(t *testing.T) {
+	area := BoundingBox(spatial.Point{Lat: 50, Lng: -125}, spatial.Point{Lat: 25, Lng: -65})
+	_, err := coverageGrid(area, 10)
+	assert.Equal(t, ErrTooManyCells, err)
+}
+
+func TestCoverageGridChecksItsBoundingBox(t *testing.T) {
+	// A sliver of a triangle across the world has few cells inside it, but
+	// its bounding box is rejected before sampling any
+	sliver := []spatial.Point{{Lat: -80, Lng: -180}, {Lat: 80, Lng: 180}, {Lat: 80, Lng: 179.9}}
+	_, err := coverageGrid(sliver, 1)
+	assert.Equal(t, ErrTooManyCells, err)
+
+	// Rows far from the equator have fewer cells, so may span more degrees
+	_, err = coverageGrid(BoundingBox(spatial.Point{Lat: 1, Lng: 0}, spatial.Point{Lat: 0, Lng: 60}), 10)
+	assert.Equal(t, ErrTooManyCells, err)
+
+	cells, err := coverageGrid(BoundingBox(spatial.Point{Lat: 81, Lng: 0}, spatial.Point{Lat: 80, Lng: 60}), 10)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, cells)
+}
+
+func TestCoverageGapsRejectsPointsOffTheGlobe(t *testing.T) {
+	// The grid of such a polygon would never advance past its first row
+	_, err := CoverageGaps([]spatial.Point{{Lat: -1e300, Lng: 0}, {Lat: 1e300, Lng: 0}, {Lat: 0, Lng: 0}}, 100, 50)
+	assert.Equal(t, ErrInvalidLatitude, err)
+
+	_, err = CoverageGaps([]spatial.Point{{Lat: 0, Lng: 0}, {Lat: 1, Lng: 181}, {Lat: 1, Lng: 0}}, 100, 50)
+	assert.Equal(t, ErrInvalidLongitude, err)
+}
+
+func TestCoverageGridChecksRowsAndColumns(t *testing.T) {
+	// A line has no columns, but too many rows
+	line := []spatial.Point{{Lat: -80, Lng: 0}, {Lat: 80, Lng: 0}, {Lat: 0, Lng: 0}}
+	_, err := coverageGrid(line, 1)
+	assert.Equal(t, ErrTooManyCells, err)
+}
+
+func TestCoverageGapsValidates(t *testing.T) {
+	_, err := CoverageGaps([]spatial.Point{{Lat: 1, Lng: 1}, {Lat: 2, Lng: 2}}, 100, 50)
+	assert.Equal(t, ErrInvalidArea, err)
+
+	area := BoundingBox(spatial.Point{Lat: 10, Lng: 0}, spatial.Point{Lat: 0, Lng: 10})
+	_, err = CoverageGaps(area, 0, 50)
+	assert.Equal(t, ErrInvalidDistance, err)
+
+	_, err = CoverageGaps(area, 100, -1)
+	assert.Equal(t, ErrInvalidDistance, err)
+
+	_, err = CoverageGaps(area, 100, 0.5)
+	assert.Equal(t, ErrInvalidDistance, err)
+
+	polygon := []spatial.Point{}
+	for i := 0; i <= maxAreaPoints; i++ {
+		polygon = append(polygon, spatial.Point{Lat: float64(i % 2), Lng: float64(i) / 10})
+	}
+	_, err = CoverageGaps(polygon, 100, 50)
+	assert.Equal(t, ErrInvalidArea, err)
+}
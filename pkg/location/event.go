@@ -0,0 +1,182 @@
+package location
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+	"gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const (
+	EventAdded   = "added"
+	EventUpdated = "updated"
+	EventRemoved = "removed"
+	// EventOpened follows the update of a location that is no longer opening
+	// soon.
+	EventOpened = "opened"
+)
+
+const (
+	// EventsChannel carries each Event as JSON once its sync commits.
+	EventsChannel = "location_events"
+	// SyncRunsChannel carries each SyncRun as JSON once it finishes.
+	SyncRunsChannel = "sync_runs"
+	// ChangedChannel carries the IDs of locations changed by a sync or
+	// Update.
+	ChangedChannel = "locations_changed"
+)
+
+// Event is a single change applied to a location by a sync.
+type Event struct {
+	Type     string                     `json:"type"`
+	Location *Location                  `json:"location"`
+	Changes  []supercharger.FieldChange `json:"changes,omitempty"`
+}
+
+// EventFilter selects events, empty fields match every event type, location
+// type, country or region.
+type EventFilter struct {
+	Events        []string
+	LocationTypes []string
+	Countries     []string
+	Regions       []string
+}
+
+// Matches reports whether the event passes the filter.
+func (f EventFilter) Matches(e Event) bool {
+	if len(f.Events) > 0 && !database.StringList(f.Events).Includes(e.Type) {
+		return false
+	}
+
+	if len(f.Countries) > 0 && !database.StringList(f.Countries).Includes(e.Location.Country) {
+		return false
+	}
+
+	if len(f.Regions) > 0 && !database.StringList(f.Regions).Includes(e.Location.Region) {
+		return false
+	}
+
+	if len(f.LocationTypes) > 0 {
+		for _, t := range e.Location.LocationType {
+			if database.StringList(f.LocationTypes).Includes(t) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// SyncListener is called within the transaction of a sync before it commits,
+// returning an error rolls the sync back. Listeners must only write to conn,
+// anything slower belongs in a worker reading what they wrote.
+type SyncListener func(conn runner.Connection, result *SyncResult) error
+
+var (
+	syncListenersMu sync.RWMutex
+	syncListeners   []SyncListener
+)
+
+// OnSync registers a listener to be called by every sync that isn't a dry
+// run, before it commits.
+func OnSync(listener SyncListener) {
+	syncListenersMu.Lock()
+	defer syncListenersMu.Unlock()
+	syncListeners = append(syncListeners, listener)
+}
+
+func notifySyncListeners(conn runner.Connection, result *SyncResult) error {
+	syncListenersMu.RLock()
+	defer syncListenersMu.RUnlock()
+	for _, listener := range syncListeners {
+		err := listener(conn, result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnChange calls handler in every process with the IDs of locations added,
+// updated or removed in any process, so caches of locations can be
+// invalidated. It's called with nil when changes may have been missed.
+func OnChange(handler database.ChangeHandler) error {
+	return database.SubscribeChanges(ChangedChannel, handler)
+}
+
+// syncEvents builds the events for a sync from the diff and the rows the
+// upsert returned.
+func syncEvents(result *SyncResult, stored []*Location) []Event {
+	byNid := map[int64]*Location{}
+	for _, l := range stored {
+		byNid[l.Nid] = l
+	}
+
+	events := []Event{}
+	for _, sc := range result.AddedLocations {
+		if l, ok := byNid[sc.Nid]; ok {
+			events = append(events, Event{Type: EventAdded, Location: l})
+		}
+	}
+
+	for _, u := range result.UpdatedLocations {
+		l, ok := byNid[u.Supercharger.Nid]
+		if !ok {
+			continue
+		}
+
+		events = append(events, Event{Type: EventUpdated, Location: l, Changes: u.Changes})
+		if u.Location.OpenSoon && !u.Supercharger.OpenSoon {
+			events = append(events, Event{Type: EventOpened, Location: l, Changes: u.Changes})
+		}
+	}
+
+	for _, l := range result.RemovedLocations {
+		events = append(events, Event{Type: EventRemoved, Location: l})
+	}
+
+	return events
+}
+
+// publishEvents sends each event on EventsChannel, they're delivered when the
+// sync's transaction commits. An event too large for a notification is
+// skipped rather than failing the sync.
+func publishEvents(conn runner.Connection, events []Event) error {
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		err = database.Notify(conn, EventsChannel, string(payload))
+		if err == database.ErrNotifyPayloadTooLarge {
+			fmt.Printf("Skipped publishing %s event for nid=%d: %v\n", e.Type, e.Location.Nid, err)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changedIDs returns the IDs of every location the sync wrote or removed.
+func changedIDs(result *SyncResult, stored []*Location) []int64 {
+	ids := []int64{}
+	for _, l := range stored {
+		ids = append(ids, l.ID)
+	}
+
+	for _, l := range result.RemovedLocations {
+		ids = append(ids, l.ID)
+	}
+
+	return ids
+}
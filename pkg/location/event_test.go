@@ -0,0 +1,48 @@
+package location
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dewski/spatial"
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+func TestEventRoundTripsAsJSON(t *testing.T) {
+	opened := time.Date(2016, 11, 2, 8, 30, 0, 0, time.UTC)
+	chargers := "8 Superchargers"
+	event := Event{
+		Type: EventOpened,
+		Location: &Location{
+			ID:       12,
+			OpenedAt: &opened,
+			Supercharger: supercharger.Supercharger{
+				Nid:          34,
+				Title:        "Barstow, CA",
+				Chargers:     &chargers,
+				Geo:          spatial.Point{Lat: 34.849, Lng: -117.085},
+				LocationType: supercharger.LocationList{"supercharger"},
+			},
+		},
+		Changes: []supercharger.FieldChange{{Field: "open_soon", Old: true, New: false}},
+	}
+
+	payload, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	decoded := Event{}
+	assert.NoError(t, json.Unmarshal(payload, &decoded))
+	assert.Equal(t, event, decoded)
+}
+
+func TestChangedIDsIncludeRemovedLocations(t *testing.T) {
+	result := &SyncResult{
+		RemovedLocations: []*Location{{ID: 3}},
+	}
+	stored := []*Location{{ID: 1}, {ID: 2}}
+
+	assert.Equal(t, []int64{1, 2, 3}, changedIDs(result, stored))
+	assert.Equal(t, []int64{}, changedIDs(&SyncResult{}, nil))
+}
@@ -0,0 +1,59 @@
+package location
+
+import (
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/database"
+)
+
+// FeedFilter narrows a feed to a single country or region, empty fields match
+// every location.
+type FeedFilter struct {
+	Country string
+	Region  string
+}
+
+// Opened returns the most recently opened locations, newest first.
+func Opened(filter FeedFilter, limit int) ([]*Location, error) {
+	return feed(filter, limit, "opened_at IS NOT NULL", "opened_at DESC, id DESC")
+}
+
+// Announced returns the most recently announced locations, newest first. A
+// location is announced when it first appears opening soon, it stays in the
+// feed once it has opened.
+func Announced(filter FeedFilter, limit int) ([]*Location, error) {
+	return feed(filter, limit, "(open_soon = true OR opened_at > created_at)", "created_at DESC, id DESC")
+}
+
+func feed(filter FeedFilter, limit int, where string, orderBy string) ([]*Location, error) {
+	locations := []*Location{}
+	builder := database.Conn().
+		Select(selectColumns...).
+		From("locations").
+		Where(where).
+		OrderBy(orderBy).
+		Limit(uint64(limit))
+
+	if filter.Country != "" {
+		builder = builder.Where("country = $1", filter.Country)
+	}
+
+	if filter.Region != "" {
+		builder = builder.Where("region = $1", filter.Region)
+	}
+
+	err := builder.QueryStructs(&locations)
+	if err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+// OpenedTime is when the location entered the opened feed.
+func (l Location) OpenedTime() time.Time {
+	if l.OpenedAt == nil {
+		return l.CreatedAt
+	}
+	return *l.OpenedAt
+}
@@ -0,0 +1,117 @@
+package location
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/database"
+)
+
+// The intervals growth may be bucketed by, as understood by date_trunc.
+const (
+	GrowthDay     = "day"
+	GrowthWeek    = "week"
+	GrowthMonth   = "month"
+	GrowthQuarter = "quarter"
+	GrowthYear    = "year"
+)
+
+var ErrUnknownInterval = apierror.New(apierror.BadUserInput, "Unknown growth interval")
+
+// GrowthBucket counts the locations announced, first seen, and opened
+// within an interval starting at Start, and up to its end.
+type GrowthBucket struct {
+	Start               time.Time `db:"start"`
+	Announced           int       `db:"announced"`
+	Opened              int       `db:"opened"`
+	CumulativeAnnounced int       `db:"cumulative_announced"`
+	CumulativeOpened    int       `db:"cumulative_opened"`
+}
+
+// Growth buckets the locations matching the filters of the scope by when
+// they were announced and opened, oldest first, with a bucket for every
+// interval in between. Removed locations aren't counted. It's cached when
+// UseCache is configured.
+func Growth(interval string, scope database.GraphQLScope) ([]GrowthBucket, error) {
+	switch interval {
+	case GrowthDay, GrowthWeek, GrowthMonth, GrowthQuarter, GrowthYear:
+	default:
+		return nil, ErrUnknownInterval
+	}
+
+	buckets := []GrowthBucket{}
+	err := queryCache.Fetch(cache.Key("growth", interval, scope.Key()), &buckets, func() error {
+		// Each location appears once when it was announced and again when it
+		// opened, the filters apply to the locations columns of both
+		changes := fmt.Sprintf(`(
+			SELECT date_trunc('%[1]s', created_at) AS start, 1 AS announced, 0 AS opened, * FROM locations
+			UNION ALL
+			SELECT date_trunc('%[1]s', opened_at) AS start, 0 AS announced, 1 AS opened, * FROM locations WHERE opened_at IS NOT NULL
+		) AS locations`, interval)
+
+		builder := database.Conn().
+			Select(
+				"start",
+				"SUM(announced)::int AS announced",
+				"SUM(opened)::int AS opened",
+				"SUM(SUM(announced)) OVER (ORDER BY start)::int AS cumulative_announced",
+				"SUM(SUM(opened)) OVER (ORDER BY start)::int AS cumulative_opened",
+			).
+			From(changes)
+
+		builder, err := applyFilters(builder, scope)
+		if err != nil {
+			return err
+		}
+
+		return builder.
+			GroupBy("start").
+			OrderBy("start").
+			QueryStructs(&buckets)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fillGrowthGaps(buckets, interval), nil
+}
+
+// fillGrowthGaps adds an empty bucket for each interval nothing happened in,
+// carrying the cumulative counts over.
+func fillGrowthGaps(buckets []GrowthBucket, interval string) []GrowthBucket {
+	filled := []GrowthBucket{}
+	for i, b := range buckets {
+		if i > 0 {
+			prev := filled[len(filled)-1]
+			for start := nextInterval(prev.Start, interval); start.Before(b.Start); start = nextInterval(start, interval) {
+				prev = GrowthBucket{
+					Start:               start,
+					CumulativeAnnounced: prev.CumulativeAnnounced,
+					CumulativeOpened:    prev.CumulativeOpened,
+				}
+				filled = append(filled, prev)
+			}
+		}
+
+		filled = append(filled, b)
+	}
+
+	return filled
+}
+
+func nextInterval(t time.Time, interval string) time.Time {
+	switch interval {
+	case GrowthDay:
+		return t.AddDate(0, 0, 1)
+	case GrowthWeek:
+		return t.AddDate(0, 0, 7)
+	case GrowthQuarter:
+		return t.AddDate(0, 3, 0)
+	case GrowthYear:
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
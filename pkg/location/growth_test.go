@@ -0,0 +1,45 @@
+package location
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+func month(m time.Month) time.Time {
+	return time.Date(2017, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestGrowthRejectsUnknownIntervals(t *testing.T) {
+	_, err := Growth("decade", database.NewGraphQLScopeWithFilters(map[string]interface{}{}))
+	assert.Equal(t, ErrUnknownInterval, err)
+}
+
+func TestFillGrowthGaps(t *testing.T) {
+	buckets := fillGrowthGaps([]GrowthBucket{
+		{Start: month(1), Announced: 2, Opened: 1, CumulativeAnnounced: 2, CumulativeOpened: 1},
+		{Start: month(4), Announced: 1, CumulativeAnnounced: 3, CumulativeOpened: 1},
+	}, GrowthMonth)
+
+	assert.Equal(t, []GrowthBucket{
+		{Start: month(1), Announced: 2, Opened: 1, CumulativeAnnounced: 2, CumulativeOpened: 1},
+		{Start: month(2), CumulativeAnnounced: 2, CumulativeOpened: 1},
+		{Start: month(3), CumulativeAnnounced: 2, CumulativeOpened: 1},
+		{Start: month(4), Announced: 1, CumulativeAnnounced: 3, CumulativeOpened: 1},
+	}, buckets)
+
+	assert.Empty(t, fillGrowthGaps([]GrowthBucket{}, GrowthMonth))
+}
+
+func TestHistoryKeepsFirstSightings(t *testing.T) {
+	h := NewHistory()
+	h.Add(month(3), []supercharger.Supercharger{{Nid: 1}, {Nid: 2, OpenSoon: true}})
+	h.Add(month(1), []supercharger.Supercharger{{Nid: 1, OpenSoon: true}})
+	h.Add(month(5), []supercharger.Supercharger{{Nid: 2}})
+
+	assert.Equal(t, map[int64]time.Time{1: month(1), 2: month(3)}, h.FirstSeen)
+	assert.Equal(t, map[int64]time.Time{1: month(3), 2: month(5)}, h.FirstOpened)
+}
@@ -0,0 +1,216 @@
+package location
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+	"gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+var ErrSyncApprovalNotFound = errors.New("No blocked sync found with that id")
+
+// SyncGuards protect against applying a partial or broken feed from Tesla. A
+// limit of zero disables that guard.
+type SyncGuards struct {
+	// MaxRemovedPercent is the largest share of stored locations a sync may
+	// remove.
+	MaxRemovedPercent float64
+	// MaxUpdatedPercent is the largest share of stored locations a sync may
+	// update.
+	MaxUpdatedPercent float64
+	// MinTotalPercent is the smallest size of the feed compared to the number
+	// of locations stored by the previous run.
+	MinTotalPercent float64
+}
+
+// DefaultSyncGuards are used unless overridden by the environment.
+var DefaultSyncGuards = SyncGuards{
+	MaxRemovedPercent: 5,
+	MaxUpdatedPercent: 25,
+	MinTotalPercent:   90,
+}
+
+// SyncGuardsFromEnv returns DefaultSyncGuards with any limits set through
+// SYNC_MAX_REMOVED_PERCENT, SYNC_MAX_UPDATED_PERCENT or SYNC_MIN_TOTAL_PERCENT.
+func SyncGuardsFromEnv() (SyncGuards, error) {
+	guards := DefaultSyncGuards
+	limits := map[string]*float64{
+		"SYNC_MAX_REMOVED_PERCENT": &guards.MaxRemovedPercent,
+		"SYNC_MAX_UPDATED_PERCENT": &guards.MaxUpdatedPercent,
+		"SYNC_MIN_TOTAL_PERCENT":   &guards.MinTotalPercent,
+	}
+
+	for key, limit := range limits {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return guards, fmt.Errorf("Invalid %s: %v", key, err)
+		}
+		*limit = f
+	}
+
+	return guards, nil
+}
+
+// Check returns a description of every guard the sync result violates.
+func (g SyncGuards) Check(result *SyncResult) []string {
+	reasons := []string{}
+	previousTotal := result.PreviousTotal()
+
+	// Nothing to compare the first sync against
+	if previousTotal == 0 {
+		return reasons
+	}
+
+	removed := percent(result.Removed, previousTotal)
+	if g.MaxRemovedPercent > 0 && removed > g.MaxRemovedPercent {
+		reasons = append(reasons, fmt.Sprintf("removes %d locations (%.1f%%), above the %.1f%% limit", result.Removed, removed, g.MaxRemovedPercent))
+	}
+
+	updated := percent(result.Updated, previousTotal)
+	if g.MaxUpdatedPercent > 0 && updated > g.MaxUpdatedPercent {
+		reasons = append(reasons, fmt.Sprintf("updates %d locations (%.1f%%), above the %.1f%% limit", result.Updated, updated, g.MaxUpdatedPercent))
+	}
+
+	total := result.Total()
+	totalPercent := percent(total, previousTotal)
+	if g.MinTotalPercent > 0 && totalPercent < g.MinTotalPercent {
+		reasons = append(reasons, fmt.Sprintf("contains %d locations, %.1f%% of the previous %d, below the %.1f%% minimum", total, totalPercent, previousTotal, g.MinTotalPercent))
+	}
+
+	return reasons
+}
+
+func percent(n, total int) float64 {
+	return float64(n) / float64(total) * 100
+}
+
+// SyncBlockedError is returned when a sync violates its guards. The changes
+// are not applied and the run is recorded until it is approved.
+type SyncBlockedError struct {
+	ApprovalID   int64
+	SnapshotHash string
+	Reasons      []string
+}
+
+func (e *SyncBlockedError) Error() string {
+	return fmt.Sprintf("Sync blocked pending approval of id=%d: %s", e.ApprovalID, strings.Join(e.Reasons, "; "))
+}
+
+// SyncApproval is a sync that was blocked by its guards. Once approved, a
+// sync of the same snapshot is applied regardless of its guards.
+type SyncApproval struct {
+	ID            int64      `db:"id"`
+	SnapshotHash  string     `db:"snapshot_hash"`
+	Reasons       Reasons    `db:"reasons"`
+	Total         int        `db:"total"`
+	PreviousTotal int        `db:"previous_total"`
+	Added         int        `db:"added"`
+	Updated       int        `db:"updated"`
+	Removed       int        `db:"removed"`
+	ApprovedAt    *time.Time `db:"approved_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+// ApproveSync marks a blocked sync as approved so the next sync of the same
+// snapshot is applied.
+func ApproveSync(approvalID int64) (*SyncApproval, error) {
+	approval := &SyncApproval{}
+	err := database.Conn().
+		Update("sync_approvals").
+		Set("approved_at", time.Now().UTC()).
+		Where("id = $1", approvalID).
+		Returning("*").
+		QueryStruct(approval)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrSyncApprovalNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+func syncApproved(conn runner.Connection, snapshotHash string) (bool, error) {
+	var approved bool
+	err := conn.
+		SQL(`SELECT EXISTS (SELECT 1 FROM sync_approvals WHERE snapshot_hash = $1 AND approved_at IS NOT NULL)`, snapshotHash).
+		QueryScalar(&approved)
+
+	return approved, err
+}
+
+func recordBlockedSync(conn runner.Connection, result *SyncResult, blocked *SyncBlockedError) error {
+	return conn.
+		InsertInto("sync_approvals").
+		Columns("snapshot_hash", "reasons", "total", "previous_total", "added", "updated", "removed", "created_at").
+		Values(blocked.SnapshotHash, Reasons(blocked.Reasons), result.Total(), result.PreviousTotal(), result.Added, result.Updated, result.Removed, time.Now().UTC()).
+		Returning("id").
+		QueryScalar(&blocked.ApprovalID)
+}
+
+// snapshotHash fingerprints the feed so an approval only applies to the exact
+// snapshot that was reviewed.
+func snapshotHash(superchargers []supercharger.Supercharger) (string, error) {
+	sorted := make([]supercharger.Supercharger, len(superchargers))
+	copy(sorted, superchargers)
+	sort.Sort(byNid(sorted))
+
+	b, err := json.Marshal(sorted)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type byNid []supercharger.Supercharger
+
+func (s byNid) Len() int           { return len(s) }
+func (s byNid) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byNid) Less(i, j int) bool { return s[i].Nid < s[j].Nid }
+
+// Reasons is a list of guard violations stored as JSON.
+type Reasons []string
+
+func (r Reasons) Value() (driver.Value, error) {
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+func (r *Reasons) Scan(src interface{}) error {
+	asBytes, ok := src.([]byte)
+	if !ok {
+		return errors.New("Scan source was not []bytes")
+	}
+
+	err := json.Unmarshal(asBytes, &r)
+	if err != nil {
+		return errors.New("Scan could not unmarshal to []string")
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package location
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/wattapp/superchargers/pkg/database"
+	"golang.org/x/net/context"
+)
+
+type loaderContextKey struct{}
+
+// Loader remembers the locations loaded while serving a single request, so
+// operations batched together don't repeat queries. A nil *Loader loads
+// every time.
+type Loader struct {
+	sync.Mutex
+	loaded       map[string]*flight
+	getLocations func(locationIDs []int64) ([]*Location, error)
+}
+
+func NewLoader() *Loader {
+	return &Loader{
+		loaded:       map[string]*flight{},
+		getLocations: getLocations,
+	}
+}
+
+// WithLoader returns a context carrying l.
+func WithLoader(ctx context.Context, l *Loader) context.Context {
+	return context.WithValue(ctx, loaderContextKey{}, l)
+}
+
+// LoaderFrom returns the loader carried by ctx, nil when there is none.
+func LoaderFrom(ctx context.Context) *Loader {
+	if ctx == nil {
+		return nil
+	}
+
+	l, _ := ctx.Value(loaderContextKey{}).(*Loader)
+	return l
+}
+
+// GetLocation returns the location with the given ID, see GetLocation.
+func (l *Loader) GetLocation(locationID int64) (*Location, error) {
+	locations, err := l.load("location", strconv.FormatInt(locationID, 10), func() ([]*Location, error) {
+		location, err := GetLocation(locationID)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*Location{location}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return locations[0], nil
+}
+
+// GetLocations returns the locations with the given IDs in the same order,
+// with nil for those that don't exist. The IDs that haven't been loaded yet
+// are loaded with a single query.
+func (l *Loader) GetLocations(locationIDs []int64) ([]*Location, error) {
+	if l == nil {
+		l = NewLoader()
+	}
+
+	l.Lock()
+	pending := map[int64]*flight{}
+	missing := []int64{}
+	for _, id := range locationIDs {
+		key := locationKey(id)
+		if _, ok := l.loaded[key]; ok {
+			continue
+		}
+
+		f := &flight{}
+		f.wg.Add(1)
+		l.loaded[key] = f
+		pending[id] = f
+		missing = append(missing, id)
+	}
+	l.Unlock()
+
+	found, err := l.getLocations(missing)
+	byID := map[int64]*Location{}
+	for _, location := range found {
+		byID[location.ID] = location
+	}
+
+	for id, f := range pending {
+		location, ok := byID[id]
+		if err != nil {
+			f.err = err
+		} else if ok {
+			f.locations = []*Location{location}
+		} else {
+			f.err = ErrNotFound
+		}
+		f.wg.Done()
+	}
+
+	locations := make([]*Location, len(locationIDs))
+	for i, id := range locationIDs {
+		l.Lock()
+		f := l.loaded[locationKey(id)]
+		l.Unlock()
+
+		f.wg.Wait()
+		if f.err == ErrNotFound {
+			continue
+		}
+		if f.err != nil {
+			return nil, f.err
+		}
+		locations[i] = f.locations[0]
+	}
+
+	return locations, nil
+}
+
+// Near returns the locations closest to the scope, see Near.
+func (l *Loader) Near(scope database.GraphQLScope) ([]*Location, error) {
+	return l.load("near", scope.Key(), func() ([]*Location, error) {
+		return Near(scope)
+	})
+}
+
+// Locations returns the locations matching the scope, see Locations.
+func (l *Loader) Locations(scope database.GraphQLScope) ([]*Location, error) {
+	return l.load("locations", scope.Key(), func() ([]*Location, error) {
+		return Locations(scope)
+	})
+}
+
+func locationKey(locationID int64) string {
+	return "location:" + strconv.FormatInt(locationID, 10)
+}
+
+// load calls fn the first time key is loaded, later and concurrent loads of
+// the same key share its result.
+func (l *Loader) load(name string, key string, fn func() ([]*Location, error)) ([]*Location, error) {
+	if l == nil {
+		return fn()
+	}
+
+	key = name + ":" + key
+
+	l.Lock()
+	if f, ok := l.loaded[key]; ok {
+		l.Unlock()
+
+		f.wg.Wait()
+		return f.locations, f.err
+	}
+
+	f := &flight{}
+	f.wg.Add(1)
+	l.loaded[key] = f
+	l.Unlock()
+
+	defer f.wg.Done()
+
+	f.locations, f.err = fn()
+	return f.locations, f.err
+}
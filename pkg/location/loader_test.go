@@ -0,0 +1,73 @@
+package location
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestLoaderLoadsEachKeyOnce(t *testing.T) {
+	l := NewLoader()
+	loads := 0
+	load := func() ([]*Location, error) {
+		loads++
+		return []*Location{{ID: int64(loads)}}, nil
+	}
+
+	first, _ := l.load("locations", "a", load)
+	again, _ := l.load("locations", "a", load)
+	other, _ := l.load("near", "a", load)
+
+	assert.Equal(t, 2, loads)
+	assert.Equal(t, first, again)
+	assert.Equal(t, int64(2), other[0].ID)
+
+	var none *Loader
+	none.load("locations", "a", load)
+	none.load("locations", "a", load)
+	assert.Equal(t, 4, loads)
+}
+
+func TestLoaderFromContext(t *testing.T) {
+	l := NewLoader()
+	assert.Equal(t, l, LoaderFrom(WithLoader(context.Background(), l)))
+	assert.Nil(t, LoaderFrom(context.Background()))
+	assert.Nil(t, LoaderFrom(nil))
+}
+
+func TestLoaderGetLocationsBatchesMissingIDs(t *testing.T) {
+	l := NewLoader()
+	queries := [][]int64{}
+	l.getLocations = func(ids []int64) ([]*Location, error) {
+		queries = append(queries, ids)
+		locations := []*Location{}
+		for _, id := range ids {
+			if id != 404 {
+				locations = append(locations, &Location{ID: id})
+			}
+		}
+		return locations, nil
+	}
+
+	locations, err := l.GetLocations([]int64{3, 1, 404, 3})
+	assert.NoError(t, err)
+	assert.Len(t, locations, 4)
+	assert.Equal(t, int64(3), locations[0].ID)
+	assert.Equal(t, int64(1), locations[1].ID)
+	assert.Nil(t, locations[2])
+	assert.Equal(t, int64(3), locations[3].ID)
+
+	locations, err = l.GetLocations([]int64{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), locations[1].ID)
+	assert.Equal(t, [][]int64{{3, 1, 404}, {2}}, queries)
+
+	location, err := l.GetLocation(2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), location.ID)
+
+	_, err = l.GetLocation(404)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Len(t, queries, 2)
+}
@@ -3,7 +3,7 @@ package location
 import (
 	"database/sql"
 	"encoding/base64"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,8 +11,13 @@ import (
 
 	"github.com/dewski/spatial"
 	"github.com/graphql-go/relay"
+	"github.com/lib/pq"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/country"
 	"github.com/wattapp/superchargers/pkg/database"
 	"github.com/wattapp/superchargers/pkg/supercharger"
+	"gopkg.in/mgutz/dat.v1"
 )
 
 var columns = []string{
@@ -53,22 +58,170 @@ var columns = []string{
 	"created_at",
 }
 
+// selectColumns are the columns read into a Location, which leaves out
+// those it has no field for such as the generated search column.
+var selectColumns = append(append([]string{"id"}, columns...), "opened_at")
+
+var (
+	ErrNotFound         = apierror.New(apierror.NotFound, "Location not found")
+	ErrInvalidLatitude  = apierror.New(apierror.BadUserInput, "Invalid latitude")
+	ErrInvalidLongitude = apierror.New(apierror.BadUserInput, "Invalid longitude")
+)
+
+// CheckPoint returns ErrInvalidLatitude or ErrInvalidLongitude when p is
+// off the globe.
+func CheckPoint(p spatial.Point) error {
+	if !(p.Lat >= -90 && p.Lat <= 90) {
+		return ErrInvalidLatitude
+	}
+
+	if !(p.Lng >= -180 && p.Lng <= 180) {
+		return ErrInvalidLongitude
+	}
+
+	return nil
+}
+
 type Location struct {
 	supercharger.Supercharger
 
-	ID        int64     `db:"id" json:"id"`
-	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	ID int64 `db:"id" json:"id"`
+	// OpenedAt is when the location was first seen open, null while it is
+	// opening soon.
+	OpenedAt  *time.Time `db:"opened_at" json:"opened_at"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
 }
 
+// UnmarshalJSON decodes a location encoded with json.Marshal. Supercharger's
+// decoder reads Tesla's feed, which would otherwise drop the location's own
+// fields and the encoded geo.
+func (l *Location) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		ID        int64         `json:"id"`
+		OpenedAt  *time.Time    `json:"opened_at"`
+		UpdatedAt time.Time     `json:"updated_at"`
+		CreatedAt time.Time     `json:"created_at"`
+		Geo       spatial.Point `json:"geo"`
+	}{}
+
+	err := json.Unmarshal(data, &l.Supercharger)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+
+	l.ID = aux.ID
+	l.OpenedAt = aux.OpenedAt
+	l.UpdatedAt = aux.UpdatedAt
+	l.CreatedAt = aux.CreatedAt
+	l.Geo = aux.Geo
+
+	return nil
+}
+
+// GetLocation returns the location with the given ID, cached when UseCache
+// is configured.
 func GetLocation(locationID int64) (*Location, error) {
+	location := &Location{}
+	key := cache.Key("location", strconv.FormatInt(locationID, 10))
+	err := queryCache.Fetch(key, location, func() error {
+		l, err := getLocation(locationID)
+		if err != nil {
+			return err
+		}
+
+		*location = *l
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+func getLocation(locationID int64) (*Location, error) {
 	location := &Location{}
 	err := database.Conn().
-		Select("*").
+		Select(selectColumns...).
 		From("locations").
 		Where("id = $1", locationID).
 		QueryStruct(location)
 
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+// getLocations loads the locations with the given IDs in a single query, in
+// no particular order.
+func getLocations(locationIDs []int64) ([]*Location, error) {
+	locations := []*Location{}
+	if len(locationIDs) == 0 {
+		return locations, nil
+	}
+
+	err := database.Conn().
+		Select(selectColumns...).
+		From("locations").
+		Where("id = ANY($1)", pq.Array(locationIDs)).
+		QueryStructs(&locations)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+// GetLocationByNid returns the location with Tesla's node ID, cached when
+// UseCache is configured.
+func GetLocationByNid(nid int64) (*Location, error) {
+	return getLocationBy("nid", nid)
+}
+
+// GetLocationByLocationID returns the location with Tesla's location ID, the
+// oldest when several share it.
+func GetLocationByLocationID(locationID string) (*Location, error) {
+	return getLocationBy("location_id", locationID)
+}
+
+// GetLocationByPath returns the location with the path of its page on
+// tesla.com, the oldest when several share it.
+func GetLocationByPath(path string) (*Location, error) {
+	return getLocationBy("path", path)
+}
+
+// getLocationBy returns the first location where the indexed column equals
+// value, or ErrNotFound.
+func getLocationBy(column string, value interface{}) (*Location, error) {
+	location := &Location{}
+	key := cache.Key("location", column, fmt.Sprint(value))
+	err := queryCache.Fetch(key, location, func() error {
+		err := database.Conn().
+			Select(selectColumns...).
+			From("locations").
+			Where(column+" = $1", value).
+			OrderBy("id").
+			Limit(1).
+			QueryStruct(location)
+
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -76,15 +229,63 @@ func GetLocation(locationID int64) (*Location, error) {
 	return location, nil
 }
 
+// LocationsByNid returns the locations with Tesla's node IDs in the same
+// order, with nil for those that don't exist.
+func LocationsByNid(nids []int64) ([]*Location, error) {
+	found := []*Location{}
+	if len(nids) > 0 {
+		err := database.Conn().
+			Select(selectColumns...).
+			From("locations").
+			Where("nid = ANY($1)", pq.Array(nids)).
+			QueryStructs(&found)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	byNid := map[int64]*Location{}
+	for _, location := range found {
+		byNid[location.Nid] = location
+	}
+
+	locations := make([]*Location, len(nids))
+	for i, nid := range nids {
+		locations[i] = byNid[nid]
+	}
+
+	return locations, nil
+}
+
+// Near returns the locations closest to the latitude and longitude of the
+// scope, cached when UseCache is configured. Identical concurrent calls share
+// a single query.
 func Near(scope database.GraphQLScope) ([]*Location, error) {
+	key := scope.Key()
+	return inflight.do("near", key, func() ([]*Location, error) {
+		locations := []*Location{}
+		err := queryCache.Fetch(cache.Key("near", key), &locations, func() (err error) {
+			locations, err = near(scope)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return locations, nil
+	})
+}
+
+func near(scope database.GraphQLScope) ([]*Location, error) {
 	lat, ok := scope.Args["latitude"].(float64)
 	if !ok {
-		return nil, errors.New("Invalid latitude")
+		return nil, ErrInvalidLatitude
 	}
 
 	lng, ok := scope.Args["longitude"].(float64)
 	if !ok {
-		return nil, errors.New("Invalid longitude")
+		return nil, ErrInvalidLongitude
 	}
 
 	point := spatial.Point{
@@ -94,7 +295,7 @@ func Near(scope database.GraphQLScope) ([]*Location, error) {
 
 	locations := []*Location{}
 	builder := database.Conn().
-		Select("*").
+		Select(selectColumns...).
 		From("locations").
 		OrderBy("geo <-> $1::geometry", point)
 
@@ -126,12 +327,53 @@ func Near(scope database.GraphQLScope) ([]*Location, error) {
 	return locations, nil
 }
 
+// Locations returns the locations matching the filters of the scope, cached
+// when UseCache is configured. Identical concurrent calls share a single
+// query.
 func Locations(scope database.GraphQLScope) ([]*Location, error) {
+	key := scope.Key()
+	return inflight.do("locations", key, func() ([]*Location, error) {
+		locations := []*Location{}
+		err := queryCache.Fetch(cache.Key("locations", key), &locations, func() (err error) {
+			locations, err = findLocations(scope)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return locations, nil
+	})
+}
+
+func findLocations(scope database.GraphQLScope) ([]*Location, error) {
 	locations := []*Location{}
 	builder := database.Conn().
-		Select("*").
+		Select(selectColumns...).
 		From("locations")
 
+	builder, err := applyFilters(builder, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	scope.OrderBy = database.OrderOnCreatedAt
+	query, err := database.ApplyGraphQLScope(builder, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = query.QueryStructs(&locations)
+	if err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+// applyFilters narrows builder to the locations matching the filters of the
+// scope, which are the arguments of the locations field.
+func applyFilters(builder *dat.SelectBuilder, scope database.GraphQLScope) (*dat.SelectBuilder, error) {
 	if scope.Args["region"] != nil {
 		var regions []string
 		for _, r := range scope.Args["region"].([]interface{}) {
@@ -154,6 +396,22 @@ func Locations(scope database.GraphQLScope) ([]*Location, error) {
 		}
 	}
 
+	if scope.Args["countryCode"] != nil {
+		var codes []string
+		for _, c := range scope.Args["countryCode"].([]interface{}) {
+			codes = append(codes, c.(string))
+		}
+
+		countries, err := country.Names(codes)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(countries) > 0 {
+			builder = builder.Where("country IN $1", countries)
+		}
+	}
+
 	if scope.Args["openSoon"] != nil {
 		builder = builder.Where("open_soon = $1", scope.Args["openSoon"])
 	}
@@ -188,18 +446,7 @@ func Locations(scope database.GraphQLScope) ([]*Location, error) {
 		}
 	}
 
-	scope.OrderBy = database.OrderOnCreatedAt
-	query, err := database.ApplyGraphQLScope(builder, scope)
-	if err != nil {
-		return nil, err
-	}
-
-	err = query.QueryStructs(&locations)
-	if err != nil {
-		return nil, err
-	}
-
-	return locations, nil
+	return builder, nil
 }
 
 func (l Location) Cursor() relay.ConnectionCursor {
@@ -257,88 +504,12 @@ func (l Location) Update(sc supercharger.Supercharger) error {
 		return err
 	}
 
-	fmt.Printf("Successfully updated nid=%d\n", l.Nid)
-
-	return nil
-}
-
-func Sync() (added, updated int, err error) {
-	added, updated = 0, 0
-	start := time.Now().UTC()
-	locations, err := supercharger.Superchargers()
+	err = database.PublishChanges(database.Conn(), ChangedChannel, []int64{l.ID})
 	if err != nil {
-		return
-	}
-
-	for _, location := range locations {
-		var l *Location
-		l, err = syncLocation(location)
-		if err != nil {
-			return
-		}
-
-		if l.CreatedAt.After(start) {
-			added += 1
-		} else if l.UpdatedAt.After(start) {
-			updated += 1
-		}
-	}
-
-	return
-}
-
-func syncLocation(sc supercharger.Supercharger) (*Location, error) {
-	location := &Location{}
-	err := database.Conn().
-		Select("*").
-		From("locations").
-		Where("nid = $1", sc.Nid).
-		QueryStruct(location)
-
-	if err != nil && err != sql.ErrNoRows {
-		return nil, err
-	}
-
-	if location.ID > 0 {
-		if !location.Supercharger.Equal(sc) {
-			fmt.Printf("Remote record for nid=%d has been updated, updating in database\n", location.Nid)
-			err = location.Update(sc)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		return location, nil
-	}
-
-	fmt.Printf("No record found for %d, preparing to create one\n", sc.Nid)
-
-	location = &Location{Supercharger: sc}
-	if sc.BaiduLat != nil && sc.BaiduLng != nil && sc.Latitude == 0.0 && sc.Longitude == 0.0 {
-		location.Geo = spatial.Point{
-			Lat: *sc.BaiduLat,
-			Lng: *sc.BaiduLng,
-		}
-	} else {
-		location.Geo = spatial.Point{
-			Lat: sc.Latitude,
-			Lng: sc.Longitude,
-		}
-	}
-	location.CreatedAt = time.Now().UTC()
-	location.UpdatedAt = time.Now().UTC()
-	err = database.Conn().
-		InsertInto("locations").
-		Columns(columns...).
-		Record(location).
-		Returning("id").
-		QueryScalar(&location.ID)
-
-	if err != nil {
-		panic(err)
+		return err
 	}
 
-	fmt.Printf("Created location %d for remote object %d at %v\n", location.ID, location.Nid, location.CreatedAt)
+	fmt.Printf("Successfully updated nid=%d\n", l.Nid)
 
-	return location, nil
+	return nil
 }
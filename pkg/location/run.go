@@ -0,0 +1,173 @@
+package location
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/metrics"
+)
+
+const (
+	SyncRunRunning   = "running"
+	SyncRunSucceeded = "succeeded"
+	SyncRunFailed    = "failed"
+	SyncRunBlocked   = "blocked"
+)
+
+// SyncRun is the record of a single sync, kept so clients can tell how fresh
+// the data is and so a stalled sync can be alerted on.
+type SyncRun struct {
+	ID           int64      `db:"id" json:"id"`
+	Status       string     `db:"status" json:"status"`
+	Source       string     `db:"source" json:"source"`
+	SnapshotHash *string    `db:"snapshot_hash" json:"snapshot_hash"`
+	Added        int        `db:"added" json:"added"`
+	Updated      int        `db:"updated" json:"updated"`
+	Unchanged    int        `db:"unchanged" json:"unchanged"`
+	Removed      int        `db:"removed" json:"removed"`
+	Error        *string    `db:"error" json:"error"`
+	StartedAt    time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt   *time.Time `db:"finished_at" json:"finished_at"`
+}
+
+// SyncRuns returns the most recent sync runs, optionally limited to the given
+// statuses.
+func SyncRuns(limit int, statuses []string) ([]*SyncRun, error) {
+	runs := []*SyncRun{}
+	builder := database.Conn().
+		Select("*").
+		From("sync_runs").
+		OrderBy("id DESC").
+		Limit(uint64(limit))
+
+	if len(statuses) > 0 {
+		builder = builder.Where("status IN $1", statuses)
+	}
+
+	err := builder.QueryStructs(&runs)
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// LastSuccessfulSync returns the most recently finished successful sync, or
+// nil when there hasn't been one.
+func LastSuccessfulSync() (*SyncRun, error) {
+	run := &SyncRun{}
+	err := database.Conn().
+		Select("*").
+		From("sync_runs").
+		Where("status = $1", SyncRunSucceeded).
+		OrderBy("finished_at DESC").
+		Limit(1).
+		QueryStruct(run)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func startSyncRun(source string) (*SyncRun, error) {
+	run := &SyncRun{
+		Status:    SyncRunRunning,
+		Source:    source,
+		StartedAt: time.Now().UTC(),
+	}
+
+	err := database.Conn().
+		InsertInto("sync_runs").
+		Columns("status", "source", "started_at").
+		Record(run).
+		Returning("id").
+		QueryScalar(&run.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// finish records the outcome of the run and publishes it on SyncRunsChannel.
+// The result may be nil when the sync failed before the feed could be
+// compared.
+func (r *SyncRun) finish(result *SyncResult, syncErr error) error {
+	finishedAt := time.Now().UTC()
+	r.FinishedAt = &finishedAt
+
+	switch syncErr.(type) {
+	case nil:
+		r.Status = SyncRunSucceeded
+	case *SyncBlockedError:
+		r.Status = SyncRunBlocked
+	default:
+		r.Status = SyncRunFailed
+	}
+
+	if syncErr != nil {
+		msg := syncErr.Error()
+		r.Error = &msg
+	}
+
+	if result != nil {
+		r.Added = result.Added
+		r.Updated = result.Updated
+		r.Unchanged = result.Unchanged
+		r.Removed = result.Removed
+		if result.SnapshotHash != "" {
+			r.SnapshotHash = &result.SnapshotHash
+		}
+	}
+
+	r.record()
+
+	_, err := database.Conn().
+		Update("sync_runs").
+		Set("status", r.Status).
+		Set("snapshot_hash", r.SnapshotHash).
+		Set("added", r.Added).
+		Set("updated", r.Updated).
+		Set("unchanged", r.Unchanged).
+		Set("removed", r.Removed).
+		Set("error", r.Error).
+		Set("finished_at", r.FinishedAt).
+		Where("id = $1", r.ID).
+		Exec()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return database.Notify(database.Conn(), SyncRunsChannel, string(payload))
+}
+
+func (r *SyncRun) record() {
+	tags := map[string]string{
+		"status": r.Status,
+		"source": r.Source,
+	}
+
+	fields := map[string]interface{}{
+		"added":     r.Added,
+		"updated":   r.Updated,
+		"unchanged": r.Unchanged,
+		"removed":   r.Removed,
+		"took":      r.FinishedAt.Sub(r.StartedAt).Seconds(),
+	}
+
+	metrics.Write("sync_run", tags, fields)
+}
@@ -0,0 +1,159 @@
+package location
+
+import (
+	"strings"
+
+	"github.com/graphql-go/relay"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/database"
+)
+
+// searchQuery parses what was typed like a web search engine, quoted
+// phrases, or and -excluded words.
+const searchQuery = "websearch_to_tsquery('simple', $1)"
+
+var ErrEmptySearch = apierror.New(apierror.BadUserInput, "Provide something to search for")
+
+// SearchResult is a location matching a search, Snippet is its name and
+// address with the matching words wrapped in <mark> and </mark>.
+type SearchResult struct {
+	Location *Location
+	Rank     float64
+	Snippet  string
+}
+
+// SearchResults is a page of the results of a search, Offset is where the
+// page starts among all Total results.
+type SearchResults struct {
+	Results []SearchResult
+	Offset  int
+	Total   int
+}
+
+type searchRow struct {
+	Location
+	Rank    float64 `db:"rank"`
+	Snippet string  `db:"snippet"`
+}
+
+// Search finds the locations whose name or address match the query and the
+// filters of the scope, the most relevant first. The connection arguments
+// of the scope pick the page, which has database.DefaultLimit results
+// unless first or last are given. It's cached when UseCache is configured.
+func Search(query string, scope database.GraphQLScope) (*SearchResults, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrEmptySearch
+	}
+
+	results := &SearchResults{}
+	err := queryCache.Fetch(cache.Key("search", query, scope.Key()), results, func() error {
+		count := database.Conn().
+			Select("count(*)").
+			From("locations").
+			Where("search @@ "+searchQuery, query)
+
+		count, err := applyFilters(count, scope)
+		if err != nil {
+			return err
+		}
+
+		err = count.QueryScalar(&results.Total)
+		if err != nil {
+			return err
+		}
+
+		start, end := searchWindow(scope.ConnectionArguments, results.Total)
+		results.Offset = start
+		results.Results = []SearchResult{}
+		if start >= end {
+			return nil
+		}
+
+		// The query is the first argument of the first condition, so it's $1
+		// in the selected columns as well
+		builder := database.Conn().
+			Select(append(
+				append([]string{}, selectColumns...),
+				"ts_rank_cd(search, "+searchQuery+") AS rank",
+				"ts_headline('simple', concat_ws(', ', title, common_name, address, city, province_state, postal_code), "+searchQuery+", 'StartSel=<mark>, StopSel=</mark>') AS snippet",
+			)...).
+			From("locations").
+			Where("search @@ "+searchQuery, query)
+
+		builder, err = applyFilters(builder, scope)
+		if err != nil {
+			return err
+		}
+
+		rows := []searchRow{}
+		err = builder.
+			OrderBy("rank DESC, id").
+			Offset(uint64(start)).
+			Limit(uint64(end - start)).
+			QueryStructs(&rows)
+		if err != nil {
+			return err
+		}
+
+		for i := range rows {
+			results.Results = append(results.Results, SearchResult{
+				Location: &rows[i].Location,
+				Rank:     rows[i].Rank,
+				Snippet:  rows[i].Snippet,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// searchWindow returns the offsets of the first result of the page and of
+// the one after its last, within total results, following the cursors and
+// counts of the connection arguments like relay's connections do.
+func searchWindow(args relay.ConnectionArguments, total int) (int, int) {
+	start := 0
+	if args.After != "" {
+		start = relay.GetOffsetWithDefault(args.After, -1) + 1
+	}
+
+	end := total
+	if args.Before != "" {
+		end = relay.GetOffsetWithDefault(args.Before, total)
+	}
+
+	switch {
+	case args.First >= 0:
+		end = min(end, start+args.First)
+	case args.Last < 0:
+		end = min(end, start+database.DefaultLimit)
+	}
+
+	if args.Last >= 0 && end-args.Last > start {
+		start = end - args.Last
+	}
+
+	if start < 0 {
+		start = 0
+	}
+
+	if end > total {
+		end = total
+	}
+
+	return start, end
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
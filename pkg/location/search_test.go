@@ -0,0 +1,31 @@
+package location
+
+import (
+	"testing"
+
+	"github.com/graphql-go/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/database"
+)
+
+func TestSearchRejectsEmptyQueries(t *testing.T) {
+	_, err := Search("  ", database.NewGraphQLScope())
+	assert.Equal(t, ErrEmptySearch, err)
+}
+
+func TestSearchWindow(t *testing.T) {
+	window := func(args map[string]interface{}, total int) []int {
+		start, end := searchWindow(relay.NewConnectionArguments(args), total)
+		return []int{start, end}
+	}
+
+	assert.Equal(t, []int{0, database.DefaultLimit}, window(map[string]interface{}{}, 200))
+	assert.Equal(t, []int{0, 3}, window(map[string]interface{}{}, 3))
+	assert.Equal(t, []int{0, 10}, window(map[string]interface{}{"first": 10}, 200))
+	assert.Equal(t, []int{5, 15}, window(map[string]interface{}{"first": 10, "after": string(relay.OffsetToCursor(4))}, 200))
+	assert.Equal(t, []int{195, 200}, window(map[string]interface{}{"first": 10, "after": string(relay.OffsetToCursor(194))}, 200))
+	assert.Equal(t, []int{190, 200}, window(map[string]interface{}{"last": 10}, 200))
+	assert.Equal(t, []int{10, 20}, window(map[string]interface{}{"last": 10, "before": string(relay.OffsetToCursor(20))}, 200))
+	assert.Equal(t, []int{0, 3}, window(map[string]interface{}{"last": 10, "before": string(relay.OffsetToCursor(3))}, 200))
+	assert.Equal(t, []int{0, 0}, window(map[string]interface{}{"first": 10}, 0))
+}
@@ -0,0 +1,119 @@
+package location
+
+import (
+	"strings"
+
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/database"
+)
+
+var ErrUnknownDimension = apierror.New(apierror.BadUserInput, "Unknown stats dimension")
+
+// statsDimensions are the columns stats may be grouped by, keyed by the
+// argument of the locations field filtering on them. A location with several
+// types is counted once for each of them.
+var statsDimensions = map[string]string{
+	"type":      "t.type",
+	"country":   "country",
+	"region":    "region",
+	"subRegion": "sub_region",
+	"openSoon":  "open_soon",
+	"isGallery": "is_gallery",
+}
+
+// stallsSQL extracts the number of Supercharger stalls from the description
+// of the chargers, such as "8 Superchargers, available 24/7". It's null when
+// the description doesn't tell.
+const stallsSQL = `substring(chargers FROM '(\d+) Superchargers?')::int`
+
+// StatsGroup counts the locations sharing the values of the dimensions they
+// were grouped by, the others are nil.
+type StatsGroup struct {
+	Type      *string `db:"type"`
+	Country   *string `db:"country"`
+	Region    *string `db:"region"`
+	SubRegion *string `db:"sub_region"`
+	OpenSoon  *bool   `db:"open_soon"`
+	IsGallery *bool   `db:"is_gallery"`
+
+	Count int `db:"count"`
+	// Stalls is the total of Supercharger stalls of the locations whose
+	// chargers tell, there are KnownStalls of them.
+	Stalls      int `db:"stalls"`
+	KnownStalls int `db:"known_stalls"`
+}
+
+// Stats counts the locations matching the filters of the scope, grouped by
+// the dimensions, the largest groups first. Without dimensions there's a
+// single group of every location. It's cached when UseCache is configured.
+func Stats(scope database.GraphQLScope, dimensions []string) ([]StatsGroup, error) {
+	columns := []string{}
+	seen := map[string]bool{}
+	byType := false
+	for _, d := range dimensions {
+		column, ok := statsDimensions[d]
+		if !ok {
+			return nil, ErrUnknownDimension
+		}
+
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+
+		byType = byType || d == "type"
+		columns = append(columns, column)
+	}
+
+	from := "locations"
+	if byType {
+		from = "locations, jsonb_array_elements_text(location_type) AS t(type)"
+	}
+
+	groups := []StatsGroup{}
+	key := cache.Key("stats", scope.Key(), strings.Join(columns, ","))
+	err := queryCache.Fetch(key, &groups, func() error {
+		selected := append([]string{}, columns...)
+		selected = append(selected,
+			"COUNT(*) AS count",
+			"COALESCE(SUM("+stallsSQL+"), 0) AS stalls",
+			"COUNT("+stallsSQL+") AS known_stalls",
+		)
+
+		builder := database.Conn().
+			Select(selected...).
+			From(from)
+
+		builder, err := applyFilters(builder, scope)
+		if err != nil {
+			return err
+		}
+
+		// Only count the types that were filtered on, not the others the
+		// locations also have
+		if byType && scope.Args["type"] != nil {
+			types := []string{}
+			for _, t := range scope.Args["type"].([]interface{}) {
+				types = append(types, t.(string))
+			}
+
+			if len(types) > 0 {
+				builder = builder.Where("t.type IN $1", types)
+			}
+		}
+
+		if len(columns) > 0 {
+			builder = builder.
+				GroupBy(strings.Join(columns, ", ")).
+				OrderBy("count DESC, " + strings.Join(columns, ", "))
+		}
+
+		return builder.QueryStructs(&groups)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
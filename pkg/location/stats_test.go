@@ -0,0 +1,20 @@
+package location
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/database"
+)
+
+func TestStatsRejectsUnknownDimensions(t *testing.T) {
+	scope := database.NewGraphQLScopeWithFilters(map[string]interface{}{})
+	_, err := Stats(scope, []string{"country", "title"})
+	assert.Equal(t, ErrUnknownDimension, err)
+}
+
+func TestStatsDimensionsMatchFilters(t *testing.T) {
+	for _, d := range []string{"type", "country", "region", "subRegion", "openSoon", "isGallery"} {
+		assert.Contains(t, statsDimensions, d)
+	}
+}
@@ -0,0 +1,437 @@
+package location
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+	"golang.org/x/net/context"
+	"gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const (
+	stagingTable     = "locations_staging"
+	stagingBatchSize = 500
+)
+
+// syncColumns are the columns sourced from Tesla, which excludes the
+// timestamps we maintain ourselves.
+var syncColumns = func() []string {
+	cols := []string{}
+	for _, c := range columns {
+		if c != "updated_at" && c != "created_at" {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}()
+
+// SyncOptions configures how a sync is applied.
+type SyncOptions struct {
+	// DryRun computes the changes a sync would make without applying them.
+	DryRun bool
+	// Guards block syncs that change an unexpected share of locations.
+	Guards SyncGuards
+	// Source identifies what started the sync in its recorded run.
+	Source string
+}
+
+// SyncResult contains the number of locations affected by a sync along with
+// the changes themselves.
+type SyncResult struct {
+	Added     int
+	Updated   int
+	Unchanged int
+	Removed   int
+	DryRun    bool
+
+	// SnapshotHash fingerprints the feed that was synced.
+	SnapshotHash string
+	// BlockedBy describes the guards a dry run would be blocked by, it's
+	// empty when the sync would be applied.
+	BlockedBy []string
+	// Events describe each applied change, they're empty for dry runs.
+	Events []Event
+
+	AddedLocations   []supercharger.Supercharger
+	UpdatedLocations []LocationUpdate
+	RemovedLocations []*Location
+}
+
+// Total is the number of locations in the feed.
+func (r SyncResult) Total() int {
+	return r.Added + r.Updated + r.Unchanged
+}
+
+// PreviousTotal is the number of locations stored before the sync, each of
+// which was either matched by the feed or removed.
+func (r SyncResult) PreviousTotal() int {
+	return r.Updated + r.Unchanged + r.Removed
+}
+
+// LocationUpdate pairs a stored location with the remote version replacing
+// it.
+type LocationUpdate struct {
+	Location     *Location
+	Supercharger supercharger.Supercharger
+	Changes      []supercharger.FieldChange
+}
+
+// Sync fetches every location from Tesla and applies them to the locations
+// table in a single transaction. The feed is loaded into a staging table,
+// upserted on nid, and any location missing from the feed is removed. On
+// error, or when running with DryRun, nothing is changed. A dry run checks
+// the guards too and reports those it would be blocked by in BlockedBy.
+//
+// A feed with countries missing from the catalog in pkg/country returns an
+// *UnmappedCountriesError. A sync that violates its guards returns a
+// *SyncBlockedError and is recorded for approval with ApproveSync. Every sync
+// other than a dry run is recorded as a SyncRun, and listeners registered
+// with OnSync are called within its transaction. Events are also published
+// to every process listening on EventsChannel, and the changed IDs to those
+// registered with OnChange.
+//
+// Cancelling ctx rolls the sync back once the statement it's running
+// finishes, the sync returns the context's error.
+func Sync(ctx context.Context, opts SyncOptions) (*SyncResult, error) {
+	if opts.DryRun {
+		return runSync(ctx, opts)
+	}
+
+	run, err := startSyncRun(opts.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := runSync(ctx, opts)
+	finishErr := run.finish(result, err)
+	if err != nil {
+		return result, err
+	}
+
+	if finishErr != nil {
+		return result, finishErr
+	}
+
+	return result, nil
+}
+
+func runSync(ctx context.Context, opts SyncOptions) (*SyncResult, error) {
+	superchargers, err := supercharger.Superchargers()
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if len(superchargers) == 0 {
+		return nil, supercharger.ErrNoSuperchargersFound
+	}
+
+	tx, err := database.Conn().Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.AutoRollback()
+
+	result, err := syncSuperchargers(ctx, tx, superchargers, opts, time.Now().UTC())
+	if blocked, ok := err.(*SyncBlockedError); ok {
+		// Record the blocked run outside of the discarded transaction
+		err = tx.Rollback()
+		if err != nil {
+			return nil, err
+		}
+
+		err = recordBlockedSync(database.Conn(), result, blocked)
+		if err != nil {
+			return nil, err
+		}
+
+		return result, blocked
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The deferred rollback discards the staging table for dry runs
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func syncSuperchargers(ctx context.Context, conn runner.Connection, superchargers []supercharger.Supercharger, opts SyncOptions, now time.Time) (*SyncResult, error) {
+	superchargers, err := normalizeCountries(uniqueSuperchargers(superchargers))
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := snapshotHash(superchargers)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stageSuperchargers(ctx, conn, superchargers)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := diffStaged(conn)
+	if err != nil {
+		return nil, err
+	}
+	result.SnapshotHash = hash
+	result.Unchanged = len(superchargers) - result.Added - result.Updated
+	result.DryRun = opts.DryRun
+
+	reasons := opts.Guards.Check(result)
+	if len(reasons) > 0 {
+		approved, err := syncApproved(conn, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if approved {
+			reasons = []string{}
+		}
+	}
+
+	if opts.DryRun {
+		result.BlockedBy = reasons
+		return result, nil
+	}
+
+	if len(reasons) > 0 {
+		return result, &SyncBlockedError{
+			SnapshotHash: hash,
+			Reasons:      reasons,
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	_, err = conn.Exec(fmt.Sprintf(
+		`DELETE FROM locations WHERE NOT EXISTS (SELECT 1 FROM %s s WHERE s.nid = locations.nid)`,
+		stagingTable,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	stored := []*Location{}
+	err = conn.SQL(upsertSQL(), now).QueryStructs(&stored)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Events = syncEvents(result, stored)
+
+	err = publishEvents(conn, result.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.PublishChanges(conn, ChangedChannel, changedIDs(result, stored))
+	if err != nil {
+		return nil, err
+	}
+
+	err = notifySyncListeners(conn, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// diffStaged compares the staging table against the stored locations and
+// returns what applying it would add, update and remove.
+func diffStaged(conn runner.Connection) (*SyncResult, error) {
+	result := &SyncResult{
+		AddedLocations:   []supercharger.Supercharger{},
+		UpdatedLocations: []LocationUpdate{},
+		RemovedLocations: []*Location{},
+	}
+
+	added := []*supercharger.Supercharger{}
+	err := conn.
+		Select("s.*").
+		From(stagingTable + " s").
+		Where("NOT EXISTS (SELECT 1 FROM locations l WHERE l.nid = s.nid)").
+		OrderBy("s.nid").
+		QueryStructs(&added)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sc := range added {
+		result.AddedLocations = append(result.AddedLocations, *sc)
+	}
+
+	changed := fmt.Sprintf("(%s) IS DISTINCT FROM (%s)", prefixColumns("l", syncColumns), prefixColumns("s", syncColumns))
+
+	previous := []*Location{}
+	err = conn.
+		Select(prefixColumns("l", selectColumns)).
+		From(fmt.Sprintf("locations l JOIN %s s ON s.nid = l.nid", stagingTable)).
+		Where(changed).
+		OrderBy("l.nid").
+		QueryStructs(&previous)
+	if err != nil {
+		return nil, err
+	}
+
+	next := []*supercharger.Supercharger{}
+	err = conn.
+		Select("s.*").
+		From(fmt.Sprintf("locations l JOIN %s s ON s.nid = l.nid", stagingTable)).
+		Where(changed).
+		OrderBy("l.nid").
+		QueryStructs(&next)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(previous) != len(next) {
+		return nil, fmt.Errorf("Staged %d updated locations but found %d stored", len(next), len(previous))
+	}
+
+	for i, l := range previous {
+		result.UpdatedLocations = append(result.UpdatedLocations, LocationUpdate{
+			Location:     l,
+			Supercharger: *next[i],
+			Changes:      l.Supercharger.Diff(*next[i]),
+		})
+	}
+
+	err = conn.
+		Select(prefixColumns("l", selectColumns)).
+		From("locations l").
+		Where(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s s WHERE s.nid = l.nid)", stagingTable)).
+		OrderBy("l.nid").
+		QueryStructs(&result.RemovedLocations)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Added = len(result.AddedLocations)
+	result.Updated = len(result.UpdatedLocations)
+	result.Removed = len(result.RemovedLocations)
+
+	return result, nil
+}
+
+// stageSuperchargers loads the remote locations into a temporary table that
+// only lives as long as the current transaction.
+func stageSuperchargers(ctx context.Context, conn runner.Connection, superchargers []supercharger.Supercharger) error {
+	_, err := conn.Exec(fmt.Sprintf(
+		`CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM locations WITH NO DATA`,
+		stagingTable,
+		strings.Join(syncColumns, ", "),
+	))
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(superchargers); start += stagingBatchSize {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		end := start + stagingBatchSize
+		if end > len(superchargers) {
+			end = len(superchargers)
+		}
+
+		builder := conn.
+			InsertInto(stagingTable).
+			Columns(syncColumns...)
+		for _, sc := range superchargers[start:end] {
+			builder = builder.Record(sc)
+		}
+
+		_, err = builder.Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// upsertSQL inserts every staged location, updating existing rows only when
+// one of the synced columns has changed. Only inserted or updated rows are
+// returned. opened_at is set when a location first appears open or stops
+// opening soon, and cleared when it's opening soon again.
+func upsertSQL() string {
+	cols := strings.Join(syncColumns, ", ")
+
+	sets := []string{}
+	for _, c := range syncColumns {
+		sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", c, c))
+	}
+	sets = append(sets, "updated_at = EXCLUDED.updated_at")
+	sets = append(sets, "opened_at = CASE WHEN EXCLUDED.open_soon THEN NULL WHEN locations.open_soon THEN EXCLUDED.updated_at ELSE locations.opened_at END")
+
+	return fmt.Sprintf(
+		`INSERT INTO locations (%s, created_at, updated_at, opened_at)
+		SELECT %s, $1, $1, CASE WHEN open_soon THEN NULL ELSE $1::timestamp END FROM %s
+		ON CONFLICT (nid) DO UPDATE SET %s
+		WHERE (%s) IS DISTINCT FROM (%s)
+		RETURNING %s`,
+		cols,
+		cols,
+		stagingTable,
+		strings.Join(sets, ", "),
+		prefixColumns("locations", syncColumns),
+		prefixColumns("EXCLUDED", syncColumns),
+		strings.Join(selectColumns, ", "),
+	)
+}
+
+// uniqueSuperchargers drops duplicate nids from the feed, keeping the last
+// occurrence, as a row can only be upserted once per statement.
+func uniqueSuperchargers(superchargers []supercharger.Supercharger) []supercharger.Supercharger {
+	seen := map[int64]int{}
+	unique := []supercharger.Supercharger{}
+	for _, sc := range superchargers {
+		if i, ok := seen[sc.Nid]; ok {
+			unique[i] = sc
+			continue
+		}
+
+		seen[sc.Nid] = len(unique)
+		unique = append(unique, sc)
+	}
+
+	return unique
+}
+
+func prefixColumns(table string, cols []string) string {
+	prefixed := []string{}
+	for _, c := range cols {
+		prefixed = append(prefixed, table+"."+c)
+	}
+	return strings.Join(prefixed, ", ")
+}
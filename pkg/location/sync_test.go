@@ -0,0 +1,136 @@
+package location
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+func TestUniqueSuperchargersKeepsLastOccurrence(t *testing.T) {
+	superchargers := []supercharger.Supercharger{
+		{Nid: 1, Title: "First"},
+		{Nid: 2, Title: "Second"},
+		{Nid: 1, Title: "First, again"},
+	}
+
+	unique := uniqueSuperchargers(superchargers)
+
+	assert.Len(t, unique, 2)
+	assert.Equal(t, "First, again", unique[0].Title)
+	assert.Equal(t, "Second", unique[1].Title)
+}
+
+func TestSyncColumnsExcludeTimestamps(t *testing.T) {
+	assert.NotContains(t, syncColumns, "created_at")
+	assert.NotContains(t, syncColumns, "updated_at")
+	assert.Contains(t, syncColumns, "nid")
+	assert.Len(t, syncColumns, len(columns)-2)
+}
+
+func TestSelectColumnsMatchLocation(t *testing.T) {
+	assert.Equal(t, "id", selectColumns[0])
+	assert.Contains(t, selectColumns, "opened_at")
+	assert.Contains(t, selectColumns, "created_at")
+	assert.NotContains(t, selectColumns, "search")
+	assert.Len(t, selectColumns, len(columns)+2)
+
+	assert.Contains(t, upsertSQL(), "RETURNING id, address, ")
+	assert.NotContains(t, upsertSQL(), "RETURNING *")
+}
+
+func TestUpsertClearsOpenedAtOfLocationsOpeningSoonAgain(t *testing.T) {
+	assert.Contains(t, upsertSQL(), "opened_at = CASE WHEN EXCLUDED.open_soon THEN NULL")
+}
+
+func TestSyncGuardsAllowExpectedChanges(t *testing.T) {
+	result := &SyncResult{
+		Added:     5,
+		Updated:   10,
+		Unchanged: 985,
+		Removed:   2,
+	}
+
+	assert.Empty(t, DefaultSyncGuards.Check(result))
+}
+
+func TestSyncGuardsBlockPartialFeed(t *testing.T) {
+	result := &SyncResult{
+		Updated:   20,
+		Unchanged: 30,
+		Removed:   950,
+	}
+
+	reasons := DefaultSyncGuards.Check(result)
+	assert.Len(t, reasons, 2)
+	assert.Contains(t, reasons[0], "removes 950 locations (95.0%)")
+	assert.Contains(t, reasons[1], "contains 50 locations, 5.0% of the previous 1000")
+}
+
+func TestSyncGuardsBlockMassUpdates(t *testing.T) {
+	result := &SyncResult{
+		Updated:   500,
+		Unchanged: 500,
+	}
+
+	reasons := DefaultSyncGuards.Check(result)
+	assert.Len(t, reasons, 1)
+	assert.Contains(t, reasons[0], "updates 500 locations (50.0%)")
+}
+
+func TestSyncGuardsSkipFirstSync(t *testing.T) {
+	result := &SyncResult{
+		Added: 1000,
+	}
+
+	assert.Empty(t, DefaultSyncGuards.Check(result))
+}
+
+func TestSyncGuardsDisabled(t *testing.T) {
+	result := &SyncResult{
+		Removed: 1000,
+	}
+
+	assert.Empty(t, SyncGuards{}.Check(result))
+}
+
+func TestSnapshotHashIgnoresOrder(t *testing.T) {
+	a, err := snapshotHash([]supercharger.Supercharger{{Nid: 1}, {Nid: 2}})
+	assert.NoError(t, err)
+
+	b, err := snapshotHash([]supercharger.Supercharger{{Nid: 2}, {Nid: 1}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, a, b)
+}
+
+func TestSyncEvents(t *testing.T) {
+	previous := &Location{ID: 2, Supercharger: supercharger.Supercharger{Nid: 2, OpenSoon: true}}
+	removed := &Location{ID: 3, Supercharger: supercharger.Supercharger{Nid: 3}}
+	result := &SyncResult{
+		AddedLocations: []supercharger.Supercharger{{Nid: 1}},
+		UpdatedLocations: []LocationUpdate{
+			{
+				Location:     previous,
+				Supercharger: supercharger.Supercharger{Nid: 2, OpenSoon: false},
+				Changes:      []supercharger.FieldChange{{Field: "open_soon", Old: true, New: false}},
+			},
+		},
+		RemovedLocations: []*Location{removed},
+	}
+	stored := []*Location{
+		{ID: 1, Supercharger: supercharger.Supercharger{Nid: 1}},
+		{ID: 2, Supercharger: supercharger.Supercharger{Nid: 2}},
+	}
+
+	events := syncEvents(result, stored)
+
+	assert.Len(t, events, 4)
+	assert.Equal(t, EventAdded, events[0].Type)
+	assert.Equal(t, int64(1), events[0].Location.ID)
+	assert.Equal(t, EventUpdated, events[1].Type)
+	assert.Equal(t, EventOpened, events[2].Type)
+	assert.Equal(t, int64(2), events[2].Location.ID)
+	assert.Equal(t, EventRemoved, events[3].Type)
+	assert.Equal(t, removed, events[3].Location)
+}
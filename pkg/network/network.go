@@ -0,0 +1,345 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/dewski/spatial"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/database"
+)
+
+const (
+	// MaxRangeKm is the longest range, beyond it nearly every station is
+	// compared with every other.
+	MaxRangeKm = 1000
+	// earthRadiusKm is the mean radius of the earth.
+	earthRadiusKm = 6371.0
+	// kmPerDegree is the length of a degree of latitude.
+	kmPerDegree = 111.19
+)
+
+var (
+	ErrInvalidRange = apierror.New(apierror.BadUserInput, "rangeKm must be positive and at most 1000")
+	ErrNotInNetwork = apierror.New(apierror.BadUserInput, "Location isn't an open Supercharger")
+)
+
+// Station is an open Supercharger of the network.
+type Station struct {
+	ID      int64         `db:"id"`
+	Title   string        `db:"title"`
+	Country string        `db:"country"`
+	Geo     spatial.Point `db:"geo"`
+}
+
+// Component is a set of stations connected to each other, and the bridges
+// among them whose removal would split it.
+type Component struct {
+	Stations []Station
+	Bridges  []Station
+}
+
+// Graph connects every pair of stations within RangeKm of each other as
+// the crow flies.
+type Graph struct {
+	RangeKm  float64
+	Stations []Station
+
+	index map[int64]int
+	edges [][]int
+}
+
+// graphCache holds the graphs built by Load for each range, nil disables
+// caching.
+var graphCache *cache.Cache
+
+// UseCache caches the graphs of Load in c. It's meant to be the cache given
+// to location.UseCache, which invalidates it when locations change.
+func UseCache(c *cache.Cache) {
+	graphCache = c
+}
+
+// cachedGraph is a Graph as it's cached, along with its edges.
+type cachedGraph struct {
+	Stations []Station
+	Edges    [][]int
+}
+
+// Load builds the graph of the open Superchargers in the locations table,
+// cached when UseCache is configured.
+func Load(rangeKm float64) (*Graph, error) {
+	if rangeKm <= 0 || rangeKm > MaxRangeKm {
+		return nil, ErrInvalidRange
+	}
+
+	cached := cachedGraph{}
+	err := graphCache.Fetch(cache.Key("network", fmt.Sprint(rangeKm)), &cached, func() error {
+		stations := []Station{}
+		err := database.Conn().
+			Select("id", "title", "country", "geo").
+			From("locations").
+			Where(`NOT open_soon AND location_type @> '["supercharger"]'`).
+			OrderBy("id").
+			QueryStructs(&stations)
+		if err != nil {
+			return err
+		}
+
+		g, err := New(stations, rangeKm)
+		if err != nil {
+			return err
+		}
+
+		cached = cachedGraph{Stations: g.Stations, Edges: g.edges}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newFromEdges(cached.Stations, cached.Edges, rangeKm), nil
+}
+
+// New builds the graph of the stations. Stations are sorted by latitude so
+// only those within rangeKm of latitude are compared.
+func New(stations []Station, rangeKm float64) (*Graph, error) {
+	if rangeKm <= 0 || rangeKm > MaxRangeKm {
+		return nil, ErrInvalidRange
+	}
+
+	g := &Graph{
+		RangeKm:  rangeKm,
+		Stations: stations,
+		index:    map[int64]int{},
+		edges:    make([][]int, len(stations)),
+	}
+
+	byLat := byLatitude{stations: stations, indexes: make([]int, len(stations))}
+	for i, s := range stations {
+		g.index[s.ID] = i
+		byLat.indexes[i] = i
+	}
+	sort.Sort(byLat)
+
+	maxLat := rangeKm / kmPerDegree
+	for a, i := range byLat.indexes {
+		for _, j := range byLat.indexes[a+1:] {
+			if stations[j].Geo.Lat-stations[i].Geo.Lat > maxLat {
+				break
+			}
+
+			if distanceKm(stations[i].Geo, stations[j].Geo) <= rangeKm {
+				g.edges[i] = append(g.edges[i], j)
+				g.edges[j] = append(g.edges[j], i)
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// newFromEdges is the graph of stations already connected by edges.
+func newFromEdges(stations []Station, edges [][]int, rangeKm float64) *Graph {
+	g := &Graph{
+		RangeKm:  rangeKm,
+		Stations: stations,
+		index:    map[int64]int{},
+		edges:    make([][]int, len(stations)),
+	}
+
+	for i, s := range stations {
+		g.index[s.ID] = i
+	}
+	copy(g.edges, edges)
+
+	return g
+}
+
+// Components returns the connected components, the largest first.
+func (g *Graph) Components() []Component {
+	bridges := g.bridges()
+	seen := make([]bool, len(g.Stations))
+	components := []Component{}
+	for i := range g.Stations {
+		if seen[i] {
+			continue
+		}
+
+		c := Component{Stations: []Station{}, Bridges: []Station{}}
+		for _, j := range g.reach(i, seen) {
+			c.Stations = append(c.Stations, g.Stations[j])
+			if bridges[j] {
+				c.Bridges = append(c.Bridges, g.Stations[j])
+			}
+		}
+		components = append(components, c)
+	}
+
+	sort.Stable(bySize(components))
+
+	return components
+}
+
+// Bridges returns the stations whose removal would split their component,
+// ordered by ID.
+func (g *Graph) Bridges() []Station {
+	stations := []Station{}
+	for i, bridge := range g.bridges() {
+		if bridge {
+			stations = append(stations, g.Stations[i])
+		}
+	}
+	sortByID(stations)
+
+	return stations
+}
+
+// Reachable returns the stations that can be reached from the station with
+// the given ID, ordered by ID and without the station itself.
+func (g *Graph) Reachable(id int64) ([]Station, error) {
+	start, ok := g.index[id]
+	if !ok {
+		return nil, ErrNotInNetwork
+	}
+
+	stations := []Station{}
+	for _, i := range g.reach(start, make([]bool, len(g.Stations))) {
+		if i != start {
+			stations = append(stations, g.Stations[i])
+		}
+	}
+	sortByID(stations)
+
+	return stations, nil
+}
+
+// reach returns the stations connected to start that aren't seen yet,
+// marking them seen.
+func (g *Graph) reach(start int, seen []bool) []int {
+	seen[start] = true
+	queue := []int{start}
+	for n := 0; n < len(queue); n++ {
+		for _, j := range g.edges[queue[n]] {
+			if !seen[j] {
+				seen[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	sort.Ints(queue)
+	return queue
+}
+
+// bridges finds the articulation points of the graph with Tarjan's
+// algorithm, a station is one when a neighbour it discovered can't reach
+// further back than it without going through it.
+func (g *Graph) bridges() []bool {
+	n := len(g.Stations)
+	bridges := make([]bool, n)
+	discovered := make([]int, n)
+	low := make([]int, n)
+	order := 0
+
+	var visit func(i, parent int)
+	visit = func(i, parent int) {
+		order++
+		discovered[i], low[i] = order, order
+		children := 0
+		for _, j := range g.edges[i] {
+			if discovered[j] == 0 {
+				children++
+				visit(j, i)
+				low[i] = min(low[i], low[j])
+				if parent >= 0 && low[j] >= discovered[i] {
+					bridges[i] = true
+				}
+			} else if j != parent {
+				low[i] = min(low[i], discovered[j])
+			}
+		}
+
+		if parent < 0 && children > 1 {
+			bridges[i] = true
+		}
+	}
+
+	for i := range g.Stations {
+		if discovered[i] == 0 {
+			visit(i, -1)
+		}
+	}
+
+	return bridges
+}
+
+// distanceKm is the great-circle distance between two points.
+func distanceKm(a, b spatial.Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func sortByID(stations []Station) {
+	sort.Sort(byID(stations))
+}
+
+// byLatitude sorts indexes of stations by the latitude of the stations.
+type byLatitude struct {
+	stations []Station
+	indexes  []int
+}
+
+func (s byLatitude) Len() int {
+	return len(s.indexes)
+}
+
+func (s byLatitude) Less(a, b int) bool {
+	return s.stations[s.indexes[a]].Geo.Lat < s.stations[s.indexes[b]].Geo.Lat
+}
+
+func (s byLatitude) Swap(a, b int) {
+	s.indexes[a], s.indexes[b] = s.indexes[b], s.indexes[a]
+}
+
+// bySize sorts components by their number of stations, the largest first.
+type bySize []Component
+
+func (c bySize) Len() int {
+	return len(c)
+}
+
+func (c bySize) Less(a, b int) bool {
+	return len(c[a].Stations) > len(c[b].Stations)
+}
+
+func (c bySize) Swap(a, b int) {
+	c[a], c[b] = c[b], c[a]
+}
+
+type byID []Station
+
+func (s byID) Len() int {
+	return len(s)
+}
+
+func (s byID) Less(a, b int) bool {
+	return s[a].ID < s[b].ID
+}
+
+func (s byID) Swap(a, b int) {
+	s[a], s[b] = s[b], s[a]
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,103 @@
+package network
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dewski/spatial"
+	"github.com/stretchr/testify/assert"
+)
+
+// station places a station lng degrees east along the equator, where a
+// degree is about 111km.
+func station(id int64, lng float64) Station {
+	return Station{ID: id, Geo: spatial.Point{Lat: 0, Lng: lng}}
+}
+
+func ids(stations []Station) []int64 {
+	result := []int64{}
+	for _, s := range stations {
+		result = append(result, s.ID)
+	}
+	return result
+}
+
+// testGraph is a chain 1-2-3 with 4 also connected to 2 and 3, and a
+// separate pair 5-6.
+func testGraph(t *testing.T) *Graph {
+	g, err := New([]Station{
+		station(1, 0),
+		station(2, 1),
+		station(3, 2),
+		{ID: 4, Geo: spatial.Point{Lat: 0.5, Lng: 1.5}},
+		station(5, 10),
+		station(6, 10.5),
+	}, 120)
+	assert.Nil(t, err)
+	return g
+}
+
+func TestNewRejectsInvalidRange(t *testing.T) {
+	_, err := New([]Station{}, 0)
+	assert.Equal(t, ErrInvalidRange, err)
+
+	_, err = New([]Station{}, MaxRangeKm+1)
+	assert.Equal(t, ErrInvalidRange, err)
+
+	_, err = Load(MaxRangeKm + 1)
+	assert.Equal(t, ErrInvalidRange, err)
+}
+
+func TestCachedGraphKeepsItsEdges(t *testing.T) {
+	g := testGraph(t)
+	b, err := json.Marshal(cachedGraph{Stations: g.Stations, Edges: g.edges})
+	assert.Nil(t, err)
+
+	cached := cachedGraph{}
+	assert.Nil(t, json.Unmarshal(b, &cached))
+
+	restored := newFromEdges(cached.Stations, cached.Edges, g.RangeKm)
+	assert.Equal(t, g, restored)
+	assert.Equal(t, g.Components(), restored.Components())
+}
+
+func TestComponents(t *testing.T) {
+	components := testGraph(t).Components()
+	assert.Len(t, components, 2)
+	assert.Equal(t, []int64{1, 2, 3, 4}, ids(components[0].Stations))
+	assert.Equal(t, []int64{2}, ids(components[0].Bridges))
+	assert.Equal(t, []int64{5, 6}, ids(components[1].Stations))
+	assert.Empty(t, components[1].Bridges)
+}
+
+func TestBridges(t *testing.T) {
+	g, err := New([]Station{station(1, 0), station(2, 1), station(3, 2), station(4, 3)}, 120)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2, 3}, ids(g.Bridges()))
+
+	assert.Equal(t, []int64{2}, ids(testGraph(t).Bridges()))
+}
+
+func TestReachable(t *testing.T) {
+	g := testGraph(t)
+
+	reachable, err := g.Reachable(3)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2, 4}, ids(reachable))
+
+	reachable, err = g.Reachable(6)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{5}, ids(reachable))
+
+	_, err = g.Reachable(7)
+	assert.Equal(t, ErrNotInNetwork, err)
+}
+
+func TestDistanceKm(t *testing.T) {
+	sf := spatial.Point{Lat: 37.7749, Lng: -122.4194}
+	la := spatial.Point{Lat: 34.0522, Lng: -118.2437}
+	assert.InDelta(t, 559, distanceKm(sf, la), 2)
+
+	// Across the antimeridian
+	assert.InDelta(t, 111, distanceKm(spatial.Point{Lng: 179.5}, spatial.Point{Lng: -179.5}), 1)
+}
@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScheduleDaily(t *testing.T) {
+	s, err := Parse("0 0 * * *")
+	assert.NoError(t, err)
+
+	assert.Equal(t, date("2016-11-05T00:00:00Z"), s.Next(date("2016-11-04T13:45:10Z")))
+	assert.Equal(t, date("2016-11-05T00:00:00Z"), s.Next(date("2016-11-04T00:00:00Z")))
+}
+
+func TestScheduleSteps(t *testing.T) {
+	s, err := Parse("*/15 9-17 * * *")
+	assert.NoError(t, err)
+
+	assert.Equal(t, date("2016-11-04T13:45:00Z"), s.Next(date("2016-11-04T13:31:00Z")))
+	assert.Equal(t, date("2016-11-05T09:00:00Z"), s.Next(date("2016-11-04T17:45:00Z")))
+}
+
+func TestScheduleDayOfWeek(t *testing.T) {
+	s, err := Parse("30 6 * * 1,3")
+	assert.NoError(t, err)
+
+	// 2016-11-04 is a Friday
+	assert.Equal(t, date("2016-11-07T06:30:00Z"), s.Next(date("2016-11-04T00:00:00Z")))
+	assert.Equal(t, date("2016-11-09T06:30:00Z"), s.Next(date("2016-11-07T06:30:00Z")))
+}
+
+func TestScheduleDayOfMonthOrWeek(t *testing.T) {
+	s, err := Parse("0 0 1 * 0")
+	assert.NoError(t, err)
+
+	assert.Equal(t, date("2016-11-06T00:00:00Z"), s.Next(date("2016-11-04T00:00:00Z")))
+	assert.Equal(t, date("2016-12-01T00:00:00Z"), s.Next(date("2016-11-27T00:00:00Z")))
+}
+
+func TestScheduleLeapDay(t *testing.T) {
+	s, err := Parse("0 0 29 2 *")
+	assert.NoError(t, err)
+
+	assert.Equal(t, date("2020-02-29T00:00:00Z"), s.Next(date("2016-11-04T00:00:00Z")))
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
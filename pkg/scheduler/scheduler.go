@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"golang.org/x/net/context"
+)
+
+// PermanentError wraps job errors that retrying won't fix.
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Scheduler runs a job on a cron schedule from several processes at once. An
+// advisory lock ensures only one process runs the job at a time, so the job
+// itself should skip work already done for the scheduled time.
+type Scheduler struct {
+	Name     string
+	Schedule *Schedule
+	// Jitter delays each run by a random duration up to this long, spreading
+	// out processes that wake at the same time.
+	Jitter time.Duration
+	// MaxRetryDuration is how long a failing job is retried for.
+	MaxRetryDuration time.Duration
+	LockKey          int64
+	// Job runs for the scheduled time and should stop once ctx is done.
+	Job func(ctx context.Context, scheduled time.Time) error
+}
+
+// Run waits for each scheduled time and runs the job until ctx is cancelled.
+// A job already running is cancelled with ctx and Run returns once it stops.
+func (s *Scheduler) Run(ctx context.Context) {
+	fmt.Printf("Scheduler %s started\n", s.Name)
+
+	for {
+		now := time.Now()
+		scheduled := s.Schedule.Next(now)
+		if scheduled.IsZero() {
+			fmt.Printf("Scheduler %s has no upcoming runs\n", s.Name)
+			return
+		}
+
+		wait := scheduled.Sub(now) + s.jitter()
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Scheduler %s stopped\n", s.Name)
+			return
+		case <-time.After(wait):
+		}
+
+		s.run(ctx, scheduled)
+	}
+}
+
+func (s *Scheduler) jitter() time.Duration {
+	if s.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(s.Jitter)))
+}
+
+// run runs the job for the scheduled time, retrying failures with an
+// exponential backoff until MaxRetryDuration has passed or ctx is cancelled.
+func (s *Scheduler) run(ctx context.Context, scheduled time.Time) {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 10 * time.Second
+	b.MaxInterval = 5 * time.Minute
+	b.MaxElapsedTime = s.MaxRetryDuration
+	b.Reset()
+
+	for {
+		ok, err := database.WithAdvisoryLock(s.LockKey, func() error {
+			return s.Job(ctx, scheduled)
+		})
+
+		if ctx.Err() != nil {
+			fmt.Printf("Scheduler %s cancelled %v\n", s.Name, scheduled)
+			return
+		}
+
+		if err == nil && !ok {
+			metrics.Incr(fmt.Sprintf("scheduler.%s.locked", s.Name))
+			fmt.Printf("Scheduler %s skipped %v, another process holds the lock\n", s.Name, scheduled)
+			return
+		}
+
+		if err == nil {
+			return
+		}
+
+		metrics.Incr(fmt.Sprintf("scheduler.%s.failed", s.Name))
+		if _, permanent := err.(PermanentError); permanent {
+			fmt.Printf("Scheduler %s failed %v: %v\n", s.Name, scheduled, err)
+			return
+		}
+
+		next := b.NextBackOff()
+		if next == backoff.Stop {
+			fmt.Printf("Scheduler %s gave up on %v: %v\n", s.Name, scheduled, err)
+			return
+		}
+
+		fmt.Printf("Scheduler %s failed %v, retrying in %v: %v\n", s.Name, scheduled, next, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next):
+		}
+	}
+}
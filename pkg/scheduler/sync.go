@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/location"
+	"golang.org/x/net/context"
+)
+
+// syncLockKey is the advisory lock held while syncing locations.
+const syncLockKey int64 = 7358201
+
+var (
+	DefaultSyncJitter        = 5 * time.Minute
+	DefaultSyncRetryDuration = 30 * time.Minute
+)
+
+// NewSyncFromEnv builds a scheduler that syncs locations on the cron schedule
+// in SYNC_SCHEDULE, e.g. "0 0 * * *" for daily at 00:00 UTC. SYNC_JITTER and
+// SYNC_RETRY_DURATION override the defaults. It returns nil when no schedule
+// is configured.
+func NewSyncFromEnv() (*Scheduler, error) {
+	expr := os.Getenv("SYNC_SCHEDULE")
+	if expr == "" {
+		return nil, nil
+	}
+
+	schedule, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	jitter, err := durationFromEnv("SYNC_JITTER", DefaultSyncJitter)
+	if err != nil {
+		return nil, err
+	}
+
+	retry, err := durationFromEnv("SYNC_RETRY_DURATION", DefaultSyncRetryDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Scheduler{
+		Name:             "sync",
+		Schedule:         schedule,
+		Jitter:           jitter,
+		MaxRetryDuration: retry,
+		LockKey:          syncLockKey,
+		Job:              syncLocations,
+	}, nil
+}
+
+func durationFromEnv(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %v", key, err)
+	}
+
+	return d, nil
+}
+
+func syncLocations(ctx context.Context, scheduled time.Time) error {
+	// Another process may have already synced while this one waited
+	last, err := location.LastSuccessfulSync()
+	if err != nil {
+		return err
+	}
+
+	if last != nil && last.FinishedAt != nil && !last.FinishedAt.Before(scheduled) {
+		fmt.Printf("Locations were already synced at %v\n", *last.FinishedAt)
+		return nil
+	}
+
+	guards, err := location.SyncGuardsFromEnv()
+	if err != nil {
+		return PermanentError{err}
+	}
+
+	result, err := location.Sync(ctx, location.SyncOptions{
+		Guards: guards,
+		Source: "scheduler",
+	})
+	if _, blocked := err.(*location.SyncBlockedError); blocked {
+		return PermanentError{err}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added: %d, Updated: %d, Unchanged: %d, Removed: %d\n", result.Added, result.Updated, result.Unchanged, result.Removed)
+
+	return nil
+}
@@ -97,6 +97,12 @@ func Superchargers() ([]Supercharger, error) {
 		return nil, errors.New("Received bad status")
 	}
 
+	return Parse(b)
+}
+
+// Parse reads the superchargers from the page Tesla lists them on, such as
+// an archived copy of it.
+func Parse(b []byte) ([]Supercharger, error) {
 	stripRe := regexp.MustCompile(`\r?\n`)
 	body := stripRe.ReplaceAllString(string(b), " ")
 
@@ -109,7 +115,7 @@ func Superchargers() ([]Supercharger, error) {
 	}
 
 	var superchargers []Supercharger
-	err = json.Unmarshal([]byte(output[1]), &superchargers)
+	err := json.Unmarshal([]byte(output[1]), &superchargers)
 	if err != nil {
 		return nil, err
 	}
@@ -253,6 +259,53 @@ func (s Supercharger) Equal(b Supercharger) bool {
 	return true
 }
 
+// FieldChange describes a single column whose value differs between two
+// versions of the same location.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// Diff returns every stored field that changed going from s to b, named by its
+// database column. Fields that aren't stored such as the Baidu coordinates are
+// ignored.
+func (s Supercharger) Diff(b Supercharger) []FieldChange {
+	changes := []FieldChange{}
+	old := reflect.ValueOf(s)
+	updated := reflect.ValueOf(b)
+	t := old.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		column := t.Field(i).Tag.Get("db")
+		if column == "" || column == "-" {
+			continue
+		}
+
+		if reflect.DeepEqual(old.Field(i).Interface(), updated.Field(i).Interface()) {
+			continue
+		}
+
+		changes = append(changes, FieldChange{
+			Field: column,
+			Old:   indirect(old.Field(i)),
+			New:   indirect(updated.Field(i)),
+		})
+	}
+
+	return changes
+}
+
+func indirect(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		return v.Elem().Interface()
+	}
+	return v.Interface()
+}
+
 func stringPointersEqual(a, b *string) bool {
 	if a == nil && b == nil {
 		return true
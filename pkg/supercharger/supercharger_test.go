@@ -514,3 +514,54 @@ func TestSuperchargerEqualityTitle(t *testing.T) {
 
 	assert.False(t, a.Equal(b))
 }
+
+func TestSuperchargerDiff(t *testing.T) {
+	pointer := "1234"
+	a := Supercharger{
+		Nid:        1,
+		Title:      "1234",
+		PostalCode: &pointer,
+		OpenSoon:   true,
+	}
+
+	b := Supercharger{
+		Nid:      1,
+		Title:    "1235",
+		OpenSoon: true,
+	}
+
+	changes := a.Diff(b)
+	assert.Equal(t, []FieldChange{
+		{Field: "postal_code", Old: "1234", New: nil},
+		{Field: "title", Old: "1234", New: "1235"},
+	}, changes)
+}
+
+func TestSuperchargerDiffIgnoresUnstoredFields(t *testing.T) {
+	lat := 1.1
+	a := Supercharger{
+		BaiduLat: &lat,
+		Latitude: 1.2,
+	}
+
+	b := Supercharger{}
+
+	assert.Empty(t, a.Diff(b))
+}
+
+func TestParse(t *testing.T) {
+	page := `<script>
+		var location_data = [{"nid": "12", "title": "Gilroy", "open_soon": "0"},
+			{"nid": "13", "title": "Hawthorne", "open_soon": "1"}];
+	</script>`
+
+	superchargers, err := Parse([]byte(page))
+	assert.NoError(t, err)
+	assert.Len(t, superchargers, 2)
+	assert.Equal(t, int64(12), superchargers[0].Nid)
+	assert.False(t, bool(superchargers[0].OpenSoon))
+	assert.True(t, bool(superchargers[1].OpenSoon))
+
+	_, err = Parse([]byte(`<html></html>`))
+	assert.Equal(t, ErrNoSuperchargersFound, err)
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"github.com/dewski/spatial"
+	"github.com/graphql-go/graphql"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+var coordinateInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "Coordinate",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"latitude": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+		"longitude": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+	},
+})
+
+// autocompleteField suggests locations as a name or city is being typed.
+func autocompleteField() *graphql.Field {
+	suggestionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "AutocompleteSuggestion",
+		Description: "A location whose title or city is like what's been typed.",
+		Fields: graphql.Fields{
+			"text": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The title or city of the location, whichever is the most alike.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(location.Suggestion).Text, nil
+				},
+			},
+			"score": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "How alike the text is, boosted when the location is near the coordinate asked for.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(location.Suggestion).Score, nil
+				},
+			},
+			"location": &graphql.Field{
+				Type: locationType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(location.Suggestion).Location, nil
+				},
+			},
+		},
+	})
+
+	return costly(fieldCost{Weight: 1, DefaultSize: location.DefaultSuggestions}, &graphql.Field{
+		Type:        graphql.NewList(suggestionType),
+		Description: "Suggests locations by title or city as they're typed, tolerating misspellings and ignoring accents, the best first. Prefixes shorter than 2 characters have no suggestions.",
+		Args: graphql.FieldConfigArgument{
+			"prefix": &graphql.ArgumentConfig{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "What's been typed so far.",
+			},
+			"near": &graphql.ArgumentConfig{
+				Type:        coordinateInput,
+				Description: "Suggestions nearer to the coordinate rank higher.",
+			},
+			"limit": &graphql.ArgumentConfig{
+				Type:         graphql.Int,
+				Description:  "How many suggestions to return, at most 50.",
+				DefaultValue: location.DefaultSuggestions,
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			near, err := nearArgument(p.Args)
+			if err != nil {
+				return nil, err
+			}
+
+			limit, _ := p.Args["limit"].(int)
+			return location.Autocomplete(p.Args["prefix"].(string), near, limit)
+		},
+	})
+}
+
+// nearArgument reads the optional near coordinate of the arguments.
+func nearArgument(args map[string]interface{}) (*spatial.Point, error) {
+	near, ok := args["near"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	lat, ok := near["latitude"].(float64)
+	if !ok {
+		return nil, location.ErrInvalidLatitude
+	}
+
+	lng, ok := near["longitude"].(float64)
+	if !ok {
+		return nil, location.ErrInvalidLongitude
+	}
+
+	return &spatial.Point{Lat: lat, Lng: lng}, nil
+}
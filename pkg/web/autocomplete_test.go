@@ -0,0 +1,20 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/dewski/spatial"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNearArgument(t *testing.T) {
+	near, err := nearArgument(map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.Nil(t, near)
+
+	near, err = nearArgument(map[string]interface{}{
+		"near": map[string]interface{}{"latitude": 34.85, "longitude": -117.08},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &spatial.Point{Lat: 34.85, Lng: -117.08}, near)
+}
@@ -0,0 +1,125 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/handler"
+	"golang.org/x/net/context"
+)
+
+const (
+	// maxBatchSize is the most operations a batch may hold.
+	maxBatchSize = 20
+	// batchWorkers is how many operations of a batch run at once.
+	batchWorkers = 4
+)
+
+// maxBatchCost caps the cost of a whole batch like that of a single
+// operation, so batching doesn't multiply what a request may cost.
+var maxBatchCost = defaultQueryLimits.MaxCost
+
+var (
+	ErrInvalidBatch  = errors.New("A batch must be a JSON array of operations")
+	ErrBatchTooLarge = errors.New("A batch may hold at most 20 operations")
+)
+
+// batchOptions reads a JSON array of operations from the body, it's false
+// when the request isn't a batch and leaves the body for queryOptions.
+func batchOptions(r *http.Request) ([]*queryRequest, bool, error) {
+	if r.Method != "POST" || r.Body == nil || !strings.HasPrefix(r.Header.Get("Content-Type"), handler.ContentTypeJSON) {
+		return nil, false, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		return nil, false, nil
+	}
+
+	batch := []*queryRequest{}
+	err = json.Unmarshal(body, &batch)
+	if err != nil {
+		return nil, true, ErrInvalidBatch
+	}
+
+	for _, req := range batch {
+		if req == nil {
+			return nil, true, ErrInvalidBatch
+		}
+	}
+
+	if len(batch) > maxBatchSize {
+		return nil, true, ErrBatchTooLarge
+	}
+
+	return batch, true, nil
+}
+
+// prepareBatch prepares each operation of a batch in order. An operation
+// that fails to prepare, or that would bring the cost of the batch over
+// maxBatchCost, has an error instead, without affecting the others.
+func prepareBatch(schema *graphql.Schema, persisted *persistedQueries, batch []*queryRequest) ([]*graphQLQuery, []error) {
+	queries := make([]*graphQLQuery, len(batch))
+	errs := make([]error, len(batch))
+
+	total := 0
+	for i, req := range batch {
+		q, err := prepareQuery(schema, persisted, req)
+		if err == nil && q.cost != nil {
+			if total+q.cost.Cost > maxBatchCost {
+				message := fmt.Sprintf("Batch cost of %d exceeds the maximum of %d", total+q.cost.Cost, maxBatchCost)
+				err = &requestError{message, codeQueryTooComplex, map[string]interface{}{"cost": q.cost}}
+			} else {
+				total += q.cost.Cost
+			}
+		}
+
+		queries[i], errs[i] = q, err
+	}
+
+	return queries, errs
+}
+
+// executeBatch runs the operations of a batch of the given size on at most
+// batchWorkers at once and returns their responses in order.
+func executeBatch(ctx context.Context, size int, run func(ctx context.Context, i int) []byte) []byte {
+	responses := make([]json.RawMessage, size)
+	operations := make(chan int)
+
+	workers := batchWorkers
+	if size < workers {
+		workers = size
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range operations {
+				responses[i] = run(ctx, i)
+			}
+		}()
+	}
+
+	for i := 0; i < size; i++ {
+		operations <- i
+	}
+	close(operations)
+	wg.Wait()
+
+	body, _ := json.MarshalIndent(responses, "", "\t")
+	return body
+}
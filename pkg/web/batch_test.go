@@ -0,0 +1,166 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/handler"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestExecuteBatchBoundsWorkers(t *testing.T) {
+	batch := []*queryRequest{}
+	for i := 0; i < 12; i++ {
+		req := &queryRequest{}
+		req.Query = strconv.Itoa(i)
+		batch = append(batch, req)
+	}
+
+	var mu sync.Mutex
+	running, most := 0, 0
+	body := executeBatch(context.Background(), len(batch), func(ctx context.Context, i int) []byte {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return []byte(batch[i].Query)
+	})
+
+	responses := []int{}
+	assert.NoError(t, json.Unmarshal(body, &responses))
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, responses)
+	assert.True(t, most <= batchWorkers)
+}
+
+func TestGraphQLHandlerExecutesBatches(t *testing.T) {
+	var err error
+	Schema, err = BuildSchema()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	defer server.Close()
+
+	tooComplex := "{ " + strings.Repeat("a: locations { title } ", 11) + "}"
+	batch, _ := json.Marshal([]map[string]interface{}{
+		{"query": "{ __typename }"},
+		{"query": tooComplex},
+		{"query": "query Named { __typename }", "operationName": "Named"},
+	})
+
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(string(batch)))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "private, no-store", res.Header.Get("Cache-Control"))
+
+	responses := []map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&responses))
+	assert.Len(t, responses, 3)
+	assert.Equal(t, map[string]interface{}{"__typename": "Query"}, responses[0]["data"])
+	assert.Nil(t, responses[1]["data"])
+	assert.Len(t, responses[1]["errors"], 1)
+	assert.Equal(t, map[string]interface{}{"__typename": "Query"}, responses[2]["data"])
+}
+
+func TestGraphQLHandlerExecutesBatchesSafely(t *testing.T) {
+	var err error
+	Schema, err = BuildSchema()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	defer server.Close()
+
+	// Introspection reads the fields of every type, which the race detector
+	// catches if the workers of the batch do so concurrently
+	queries := []map[string]interface{}{}
+	for i := 0; i < batchWorkers*2; i++ {
+		queries = append(queries, map[string]interface{}{"query": "{ __schema { types { name fields { name } } } }"})
+	}
+	batch, _ := json.Marshal(queries)
+
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(string(batch)))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	responses := []map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&responses))
+	assert.Len(t, responses, len(queries))
+	for _, r := range responses {
+		assert.Nil(t, r["errors"])
+	}
+}
+
+func TestGraphQLHandlerRejectsLargeBatches(t *testing.T) {
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	defer server.Close()
+
+	batch := "[" + strings.TrimSuffix(strings.Repeat(`{"query":"{ __typename }"},`, maxBatchSize+1), ",") + "]"
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(batch))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, err = http.Post(server.URL, "application/json", strings.NewReader(`[null]`))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestGraphQLHandlerCapsBatchCost(t *testing.T) {
+	var err error
+	Schema, err = BuildSchema()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	defer server.Close()
+
+	// Each costs 606, within the limit of an operation but not both of
+	// them. The field doesn't exist so they don't reach the database.
+	query := "{ " + strings.Repeat("a: locations { nope } ", 6) + "}"
+	batch, _ := json.Marshal([]map[string]interface{}{
+		{"query": query},
+		{"query": query},
+		{"query": "{ __typename }"},
+	})
+
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(string(batch)))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	responses := []struct {
+		Errors []responseError `json:"errors"`
+	}{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&responses))
+	assert.Len(t, responses, 3)
+	assert.Len(t, responses[0].Errors, 6)
+	assert.Contains(t, responses[0].Errors[0].Message, "nope")
+	assert.Len(t, responses[1].Errors, 1)
+	assert.Equal(t, "Batch cost of 1212 exceeds the maximum of 1000", responses[1].Errors[0].Message)
+	assert.Equal(t, codeQueryTooComplex, responses[1].Errors[0].Extensions.Code)
+	assert.Empty(t, responses[2].Errors)
+}
+
+func TestGraphQLHandlerLimitsBodySize(t *testing.T) {
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	defer server.Close()
+
+	body := `[{"query":"{ __typename }","variables":{"padding":"` + strings.Repeat("a", maxBodySize) + `"}}]`
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
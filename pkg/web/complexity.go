@@ -0,0 +1,330 @@
+package web
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// queryLimits bounds what a single operation may request before it's
+// executed.
+type queryLimits struct {
+	MaxDepth   int
+	MaxAliases int
+	MaxCost    int
+}
+
+var defaultQueryLimits = queryLimits{
+	MaxDepth:   10,
+	MaxAliases: 20,
+	MaxCost:    1000,
+}
+
+// fieldCost weighs a field that loads from the database. A list costs a
+// point more for every itemsPerCost items it loads, which is first or last
+// when given and DefaultSize otherwise, and multiplies the cost of its
+// selections by that size.
+type fieldCost struct {
+	Weight      int
+	DefaultSize int
+}
+
+const itemsPerCost = 10
+
+// costCeiling keeps nested lists from overflowing the cost.
+const costCeiling = 1 << 30
+
+var (
+	declaredCosts = map[*graphql.Field]fieldCost{}
+	// fieldCosts are the declared costs by type and field name, indexed by
+	// withCosts. Other fields are free.
+	fieldCosts = map[string]fieldCost{}
+)
+
+// costly declares the cost of field where it's defined, which withCosts
+// indexes once the field is part of a type.
+func costly(cost fieldCost, field *graphql.Field) *graphql.Field {
+	declaredCosts[field] = cost
+	return field
+}
+
+// withCosts indexes the costs declared for the fields of the type named
+// typeName.
+func withCosts(typeName string, fields graphql.Fields) graphql.Fields {
+	for name, field := range fields {
+		if cost, ok := declaredCosts[field]; ok {
+			fieldCosts[typeName+"."+name] = cost
+		}
+	}
+
+	return fields
+}
+
+// queryCost is the static analysis of an operation, reported in the
+// extensions of its response.
+type queryCost struct {
+	Depth   int `json:"depth"`
+	Aliases int `json:"aliases"`
+	Cost    int `json:"cost"`
+	MaxCost int `json:"maxCost"`
+}
+
+// analyze computes the cost of the query's operation, returning a
+// *requestError when it's over the limits. Queries that don't parse or
+// have no such operation are left for the handler to report.
+func (q *graphQLQuery) analyze(schema *graphql.Schema, limits queryLimits) error {
+	if q.operation == nil {
+		return nil
+	}
+
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+
+	a := &costAnalysis{
+		schema:    schema,
+		variables: q.Variables,
+		defaults:  map[string]ast.Value{},
+		fragments: map[string]*ast.FragmentDefinition{},
+		visiting:  map[string]bool{},
+		spreads:   map[string]fragmentCost{},
+		cost:      &queryCost{MaxCost: limits.MaxCost},
+	}
+
+	for _, def := range q.document.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			a.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	for _, def := range q.operation.VariableDefinitions {
+		if def.Variable != nil && def.DefaultValue != nil {
+			a.defaults[def.Variable.Name.Value] = def.DefaultValue
+		}
+	}
+
+	root := schema.QueryType()
+	switch q.operation.Operation {
+	case ast.OperationTypeMutation:
+		root = schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = schema.SubscriptionType()
+	}
+
+	if root != nil {
+		a.walk(q.operation.SelectionSet, root, 1, 1)
+	}
+	q.cost = a.cost
+
+	message := ""
+	switch {
+	case a.cost.Depth > limits.MaxDepth:
+		message = fmt.Sprintf("Query depth of %d exceeds the maximum of %d", a.cost.Depth, limits.MaxDepth)
+	case a.cost.Aliases > limits.MaxAliases:
+		message = fmt.Sprintf("Query uses %d aliases, more than the maximum of %d", a.cost.Aliases, limits.MaxAliases)
+	case a.cost.Cost > limits.MaxCost:
+		message = fmt.Sprintf("Query cost of %d exceeds the maximum of %d", a.cost.Cost, limits.MaxCost)
+	default:
+		return nil
+	}
+
+	return &requestError{message, codeQueryTooComplex, map[string]interface{}{"cost": a.cost}}
+}
+
+type costAnalysis struct {
+	schema    *graphql.Schema
+	variables map[string]interface{}
+	// defaults are the default values of the operation's variables, used
+	// when a variable isn't given.
+	defaults  map[string]ast.Value
+	fragments map[string]*ast.FragmentDefinition
+	// visiting guards against fragments spreading themselves, which fails
+	// validation later.
+	visiting map[string]bool
+	// spreads memoizes the cost of each fragment, so spreading a fragment
+	// many times doesn't walk it again.
+	spreads map[string]fragmentCost
+	cost    *queryCost
+}
+
+// fragmentCost is the cost of a fragment's selections at depth 1 resolved
+// once, spreading it scales the cost by the multiplier and adds the depth.
+type fragmentCost struct {
+	depth   int
+	aliases int
+	cost    int
+}
+
+// walk adds the cost of the selections on parent, which are depth levels
+// deep and resolved multiplier times.
+func (a *costAnalysis) walk(set *ast.SelectionSet, parent graphql.Type, depth int, multiplier int) {
+	if set == nil || parent == nil {
+		return
+	}
+
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			name := s.Name.Value
+			// Introspection is answered from memory
+			if strings.HasPrefix(name, "__") {
+				continue
+			}
+
+			if s.Alias != nil && s.Alias.Value != name {
+				a.cost.Aliases = saturatingAdd(a.cost.Aliases, 1)
+			}
+
+			if depth > a.cost.Depth {
+				a.cost.Depth = depth
+			}
+
+			field := fieldDefinition(parent, name)
+			if field == nil {
+				continue
+			}
+
+			childMultiplier := multiplier
+			if fc, ok := fieldCosts[parent.Name()+"."+name]; ok {
+				size := fc.DefaultSize
+				if n, ok := a.intArgument(s, "first"); ok {
+					size = n
+				} else if n, ok := a.intArgument(s, "last"); ok {
+					size = n
+				}
+
+				a.cost.Cost = saturatingAdd(a.cost.Cost, saturatingMul(multiplier, fc.Weight+size/itemsPerCost))
+				if size > 0 {
+					childMultiplier = saturatingMul(multiplier, size)
+				}
+			}
+
+			child, _ := graphql.GetNamed(field.Type).(graphql.Type)
+			a.walk(s.SelectionSet, child, depth+1, childMultiplier)
+		case *ast.InlineFragment:
+			t := parent
+			if s.TypeCondition != nil {
+				t = a.schema.Type(s.TypeCondition.Name.Value)
+			}
+			a.walk(s.SelectionSet, t, depth, multiplier)
+		case *ast.FragmentSpread:
+			fc, ok := a.fragmentCost(s.Name.Value)
+			if !ok {
+				continue
+			}
+
+			if fc.depth > 0 && depth+fc.depth-1 > a.cost.Depth {
+				a.cost.Depth = depth + fc.depth - 1
+			}
+			a.cost.Aliases = saturatingAdd(a.cost.Aliases, fc.aliases)
+			a.cost.Cost = saturatingAdd(a.cost.Cost, saturatingMul(multiplier, fc.cost))
+		}
+	}
+}
+
+// fragmentCost returns the cost of the fragment named name, walking it the
+// first time. It's false for unknown fragments and those spreading
+// themselves.
+func (a *costAnalysis) fragmentCost(name string) (fragmentCost, bool) {
+	if fc, ok := a.spreads[name]; ok {
+		return fc, true
+	}
+
+	fragment, ok := a.fragments[name]
+	if !ok || a.visiting[name] {
+		return fragmentCost{}, false
+	}
+
+	sub := *a
+	sub.cost = &queryCost{}
+
+	a.visiting[name] = true
+	sub.walk(fragment.SelectionSet, a.schema.Type(fragment.TypeCondition.Name.Value), 1, 1)
+	delete(a.visiting, name)
+
+	fc := fragmentCost{sub.cost.Depth, sub.cost.Aliases, sub.cost.Cost}
+	a.spreads[name] = fc
+	return fc, true
+}
+
+// intArgument returns the value of a non-negative integer argument given
+// literally, as a variable or as the default of a variable. Values over
+// costCeiling count as costCeiling.
+func (a *costAnalysis) intArgument(field *ast.Field, name string) (int, bool) {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != name {
+			continue
+		}
+
+		v, ok := arg.Value.(*ast.Variable)
+		if !ok {
+			return intValue(arg.Value)
+		}
+
+		value, given := a.variables[v.Name.Value]
+		if !given {
+			return intValue(a.defaults[v.Name.Value])
+		}
+
+		// Variables are decoded from JSON
+		n, ok := value.(float64)
+		if !ok || n < 0 {
+			return 0, false
+		}
+		if n > costCeiling {
+			return costCeiling, true
+		}
+		return int(n), true
+	}
+
+	return 0, false
+}
+
+// intValue returns the value of a non-negative integer literal, up to
+// costCeiling.
+func intValue(value ast.Value) (int, bool) {
+	v, ok := value.(*ast.IntValue)
+	if !ok || strings.HasPrefix(v.Value, "-") {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(v.Value)
+	if err != nil {
+		if e, ok := err.(*strconv.NumError); !ok || e.Err != strconv.ErrRange {
+			return 0, false
+		}
+		n = costCeiling
+	}
+
+	if n > costCeiling {
+		return costCeiling, true
+	}
+	return n, true
+}
+
+func fieldDefinition(parent graphql.Type, name string) *graphql.FieldDefinition {
+	switch t := parent.(type) {
+	case *graphql.Object:
+		return t.Fields()[name]
+	case *graphql.Interface:
+		return t.Fields()[name]
+	}
+
+	return nil
+}
+
+func saturatingAdd(a, b int) int {
+	if a+b > costCeiling {
+		return costCeiling
+	}
+	return a + b
+}
+
+func saturatingMul(a, b int) int {
+	if a != 0 && b > costCeiling/a {
+		return costCeiling
+	}
+	return a * b
+}
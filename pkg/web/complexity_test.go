@@ -0,0 +1,149 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func analyze(t *testing.T, query string, variables map[string]interface{}, limits queryLimits) (*queryCost, error) {
+	schema, err := BuildSchema()
+	assert.NoError(t, err)
+
+	q := parseQuery(&handler.RequestOptions{Query: query, Variables: variables})
+	err = q.analyze(&schema, limits)
+	return q.cost, err
+}
+
+func TestAnalyzeWeighsListsBySize(t *testing.T) {
+	cost, err := analyze(t, `{ locations { title emails { email } } }`, nil, defaultQueryLimits)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cost.Depth)
+	assert.Equal(t, 101, cost.Cost)
+
+	cost, err = analyze(t, `query($n: Int) { locations(first: $n) { title } }`, map[string]interface{}{"n": float64(50)}, defaultQueryLimits)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, cost.Cost)
+
+	cost, err = analyze(t, `{ webhooks { deliveries(first: 10) { id } } }`, nil, defaultQueryLimits)
+	assert.NoError(t, err)
+	assert.Equal(t, 6+50*2, cost.Cost)
+
+	cost, err = analyze(t, `{ regions { countries { name } } }`, nil, defaultQueryLimits)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cost.Cost)
+}
+
+func TestAnalyzeClampsHugeSizes(t *testing.T) {
+	for _, query := range []string{
+		`{ webhooks { deliveries(first: 2000000000) { id } } }`,
+		`{ webhooks { deliveries(last: 99999999999999999999) { id } } }`,
+		`query($n: Int = 2000000000) { webhooks { deliveries(first: $n) { id } } }`,
+	} {
+		cost, err := analyze(t, query, nil, defaultQueryLimits)
+		assert.EqualError(t, err, fmt.Sprintf("Query cost of %d exceeds the maximum of 1000", costCeiling), query)
+		assert.Equal(t, costCeiling, cost.Cost)
+	}
+
+	cost, err := analyze(t, `query($n: Int) { webhooks { deliveries(first: $n) { id } } }`, map[string]interface{}{"n": float64(1e12)}, defaultQueryLimits)
+	assert.Error(t, err)
+	assert.Equal(t, costCeiling, cost.Cost)
+}
+
+func TestAnalyzeReadsVariableDefaults(t *testing.T) {
+	cost, err := analyze(t, `query($n: Int = 50) { locations(first: $n) { title } }`, nil, defaultQueryLimits)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, cost.Cost)
+
+	// A given variable overrides its default
+	cost, err = analyze(t, `query($n: Int = 2000000000) { locations(first: $n) { title } }`, map[string]interface{}{"n": float64(50)}, defaultQueryLimits)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, cost.Cost)
+}
+
+func TestAnalyzeFollowsFragments(t *testing.T) {
+	query := `
+		query { node(id: "TG9jYXRpb246MQ==") { ...location } }
+		fragment location on Location { title ...location }
+	`
+	cost, err := analyze(t, query, nil, defaultQueryLimits)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cost.Depth)
+	assert.Equal(t, 1, cost.Cost)
+}
+
+func TestAnalyzeWeighsFragmentsOnceEach(t *testing.T) {
+	cost, err := analyze(t, `{ ...twice ...twice } fragment twice on Query { locations(first: 10) { title } }`, nil, defaultQueryLimits)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cost.Depth)
+	assert.Equal(t, 4, cost.Cost)
+
+	// Each fragment spreads the next twice, walking them all would take 2^40
+	// steps
+	fragments := []string{}
+	for i := 0; i < 40; i++ {
+		fragments = append(fragments, fmt.Sprintf("fragment f%d on Query { ...f%d ...f%d }", i, i+1, i+1))
+	}
+	fragments = append(fragments, "fragment f40 on Query { locations { title } }")
+
+	cost, err = analyze(t, "{ ...f0 } "+strings.Join(fragments, " "), nil, defaultQueryLimits)
+	assert.EqualError(t, err, fmt.Sprintf("Query cost of %d exceeds the maximum of 1000", costCeiling))
+	assert.Equal(t, costCeiling, cost.Cost)
+}
+
+func TestAnalyzeRejectsOverLimits(t *testing.T) {
+	aliased := func(n int, field string) string {
+		fields := []string{}
+		for i := 0; i < n; i++ {
+			fields = append(fields, "a"+strings.Repeat("a", i)+": "+field)
+		}
+		return "{ " + strings.Join(fields, " ") + " }"
+	}
+
+	_, err := analyze(t, aliased(15, "locations { title }"), nil, defaultQueryLimits)
+	assert.EqualError(t, err, "Query cost of 1515 exceeds the maximum of 1000")
+
+	_, err = analyze(t, aliased(25, "locations(first: 1) { title }"), nil, defaultQueryLimits)
+	assert.EqualError(t, err, "Query uses 25 aliases, more than the maximum of 20")
+
+	_, err = analyze(t, `{ locations { emails { email } } }`, nil, queryLimits{MaxDepth: 2, MaxAliases: 20, MaxCost: 1000})
+	assert.EqualError(t, err, "Query depth of 3 exceeds the maximum of 2")
+}
+
+func TestGraphQLHandlerReportsCost(t *testing.T) {
+	var err error
+	Schema, err = BuildSchema()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	defer server.Close()
+
+	post := func(query string) map[string]interface{} {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		res, err := http.Post(server.URL, "application/json", strings.NewReader(string(body)))
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		b, _ := ioutil.ReadAll(res.Body)
+		response := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(b, &response))
+		return response
+	}
+
+	response := post(`{ __typename }`)
+	assert.Equal(t, map[string]interface{}{"__typename": "Query"}, response["data"])
+	assert.Equal(t, map[string]interface{}{"depth": float64(0), "aliases": float64(0), "cost": float64(0), "maxCost": float64(1000)}, response["extensions"].(map[string]interface{})["cost"])
+
+	response = post(`{ a: locations { title } b: locations { title } c: locations { title } d: locations { title } e: locations { title } f: locations { title } g: locations { title } h: locations { title } i: locations { title } j: locations { title } }`)
+	assert.Nil(t, response["data"])
+	errs := response["errors"].([]interface{})
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "QUERY_TOO_COMPLEX", errs[0].(map[string]interface{})["extensions"].(map[string]interface{})["code"])
+}
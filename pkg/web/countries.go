@@ -0,0 +1,194 @@
+package web
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/wattapp/superchargers/pkg/country"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+var enumRegion = graphql.NewEnum(graphql.EnumConfig{
+	Name: "Region",
+	Values: func() graphql.EnumValueConfigMap {
+		values := graphql.EnumValueConfigMap{}
+		for _, r := range country.Regions {
+			values[country.EnumName(r.Key)] = &graphql.EnumValueConfig{
+				Value:       r.Key,
+				Description: r.Name,
+			}
+		}
+		return values
+	}(),
+})
+
+var enumCountry = graphql.NewEnum(graphql.EnumConfig{
+	Name: "Country",
+	Values: func() graphql.EnumValueConfigMap {
+		values := graphql.EnumValueConfigMap{}
+		for _, c := range country.Countries {
+			values[country.EnumName(c.Name)] = &graphql.EnumValueConfig{
+				Value:       c.Name,
+				Description: c.Alpha2 + ", " + c.Alpha3,
+			}
+		}
+		return values
+	}(),
+})
+
+// countrySummary is a country of the catalog along with its number of
+// locations.
+type countrySummary struct {
+	country.Country
+	LocationCount int
+}
+
+// regionSummary is a region of the catalog along with its countries and
+// number of locations.
+type regionSummary struct {
+	country.Region
+	Countries     []*countrySummary
+	LocationCount int
+}
+
+var countrySummaryType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "CountrySummary",
+	Description: "A country Tesla operates in.",
+	Fields: graphql.Fields{
+		"country": &graphql.Field{
+			Type:        enumCountry,
+			Description: "The country as used in filters.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*countrySummary).Name, nil
+			},
+		},
+		"name": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The country as Tesla spells it, which is the country of its locations.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*countrySummary).Name, nil
+			},
+		},
+		"alpha2": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The ISO 3166-1 alpha-2 code of the country.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*countrySummary).Alpha2, nil
+			},
+		},
+		"alpha3": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The ISO 3166-1 alpha-3 code of the country.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*countrySummary).Alpha3, nil
+			},
+		},
+		"region": &graphql.Field{
+			Type:        enumRegion,
+			Description: "The region Tesla places the country in.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*countrySummary).Region, nil
+			},
+		},
+		"locationCount": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The number of locations in the country.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*countrySummary).LocationCount, nil
+			},
+		},
+	},
+})
+
+var regionSummaryType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "RegionSummary",
+	Description: "A region Tesla groups countries in.",
+	Fields: withCosts("RegionSummary", graphql.Fields{
+		"region": &graphql.Field{
+			Type:        enumRegion,
+			Description: "The region as used in filters.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*regionSummary).Key, nil
+			},
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*regionSummary).Name, nil
+			},
+		},
+		"countries": costly(fieldCost{Weight: 1}, &graphql.Field{
+			Type:        graphql.NewList(countrySummaryType),
+			Description: "The countries of the region.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*regionSummary).Countries, nil
+			},
+		}),
+		"locationCount": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The number of locations in the region.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*regionSummary).LocationCount, nil
+			},
+		},
+	}),
+})
+
+// countryFields list the countries and regions of the catalog, including
+// those without locations yet.
+func countryFields() graphql.Fields {
+	return graphql.Fields{
+		"countries": &graphql.Field{
+			Type:        graphql.NewList(countrySummaryType),
+			Description: "The countries Tesla operates in, with their ISO codes and number of locations.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				counts, err := location.CountByCountry()
+				if err != nil {
+					return nil, err
+				}
+
+				return countrySummaries(country.Countries, counts), nil
+			},
+		},
+		"regions": costly(fieldCost{Weight: 1}, &graphql.Field{
+			Type:        graphql.NewList(regionSummaryType),
+			Description: "The regions Tesla groups countries in, with their number of locations.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				counts, err := location.CountByCountry()
+				if err != nil {
+					return nil, err
+				}
+
+				return regionSummaries(counts), nil
+			},
+		}),
+	}
+}
+
+// regionSummaries returns the regions of the catalog, each counting the
+// locations of its countries so the region and its countries always agree.
+func regionSummaries(counts map[string]int) []*regionSummary {
+	regions := []*regionSummary{}
+	for _, r := range country.Regions {
+		summary := &regionSummary{
+			Region:    r,
+			Countries: countrySummaries(country.InRegion(r.Key), counts),
+		}
+		for _, c := range summary.Countries {
+			summary.LocationCount += c.LocationCount
+		}
+		regions = append(regions, summary)
+	}
+
+	return regions
+}
+
+func countrySummaries(countries []country.Country, counts map[string]int) []*countrySummary {
+	summaries := []*countrySummary{}
+	for _, c := range countries {
+		summaries = append(summaries, &countrySummary{
+			Country:       c,
+			LocationCount: counts[c.Name],
+		})
+	}
+
+	return summaries
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/country"
+)
+
+func TestCountryEnumsFollowCatalog(t *testing.T) {
+	assert.Len(t, enumCountry.Values(), len(country.Countries))
+	assert.Len(t, enumRegion.Values(), len(country.Regions))
+
+	value, ok := enumValueForSlug(enumCountry, "united-states")
+	assert.True(t, ok)
+	assert.Equal(t, "United States", value)
+
+	value, ok = enumValueForSlug(enumRegion, "middle-east")
+	assert.True(t, ok)
+	assert.Equal(t, "middle_east", value)
+}
+
+func TestCountrySummaries(t *testing.T) {
+	summaries := countrySummaries(country.InRegion("north_america"), map[string]int{"Canada": 3})
+	assert.Len(t, summaries, 4)
+	assert.Equal(t, "Canada", summaries[0].Name)
+	assert.Equal(t, 3, summaries[0].LocationCount)
+	assert.Equal(t, 0, summaries[1].LocationCount)
+}
+
+func TestRegionSummariesCountTheirCountries(t *testing.T) {
+	// Locations of countries missing from the catalog aren't counted
+	regions := regionSummaries(map[string]int{"Canada": 3, "United States": 5, "Germany": 2, "Atlantis": 7})
+	assert.Len(t, regions, len(country.Regions))
+
+	assert.Equal(t, "north_america", regions[0].Key)
+	assert.Equal(t, 8, regions[0].LocationCount)
+	assert.Len(t, regions[0].Countries, 4)
+
+	assert.Equal(t, "europe", regions[1].Key)
+	assert.Equal(t, 2, regions[1].LocationCount)
+	assert.Equal(t, 0, regions[2].LocationCount)
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"github.com/dewski/spatial"
+	"github.com/graphql-go/graphql"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+// defaultGridKm is how far apart coverage gaps are sampled by default.
+const defaultGridKm = 50.0
+
+// coverageGapsField finds where the network has holes, for telling whether
+// a trip is possible.
+func coverageGapsField() *graphql.Field {
+	coverageGapType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "CoverageGap",
+		Description: "A cell of the sampled grid that's too far from an open Supercharger.",
+		Fields: graphql.Fields{
+			"latitude": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "The latitude of the center of the cell.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(location.CoverageGap).Latitude, nil
+				},
+			},
+			"longitude": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "The longitude of the center of the cell.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(location.CoverageGap).Longitude, nil
+				},
+			},
+			"distanceKm": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "The distance to the nearest open Supercharger as the crow flies, null when there's none.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					gap := p.Source.(location.CoverageGap)
+					if gap.DistanceKm == nil {
+						return nil, nil
+					}
+					return *gap.DistanceKm, nil
+				},
+			},
+			"nearest": &graphql.Field{
+				Type:        locationType,
+				Description: "The nearest open Supercharger.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					gap := p.Source.(location.CoverageGap)
+					if gap.NearestID == nil {
+						return nil, nil
+					}
+					return location.LoaderFrom(p.Context).GetLocation(*gap.NearestID)
+				},
+			},
+		},
+	})
+
+	return costly(fieldCost{Weight: 100, DefaultSize: 50}, &graphql.Field{
+		Type:        graphql.NewList(coverageGapType),
+		Description: "Samples a grid within an area and returns the cells further than maxDistanceKm from the nearest open Supercharger, the furthest first.",
+		Args: graphql.FieldConfigArgument{
+			"boundingBox": &graphql.ArgumentConfig{
+				Type:        graphql.NewList(graphql.Float),
+				Description: "The 4 coordinates to make a bounding box in the following order: [North West Latitude, North West Longitude, South East Latitude, South East Longitude]",
+			},
+			"polygon": &graphql.ArgumentConfig{
+				Type:        graphql.NewList(graphql.NewList(graphql.Float)),
+				Description: "The [latitude, longitude] points of a polygon to sample instead of a bounding box, at most 200.",
+			},
+			"maxDistanceKm": &graphql.ArgumentConfig{
+				Type:        graphql.NewNonNull(graphql.Float),
+				Description: "How far the nearest open Supercharger may be.",
+			},
+			"gridKm": &graphql.ArgumentConfig{
+				Type:         graphql.Float,
+				Description:  "How far apart cells are, at least 1. The bounding box of the area may have at most 2500 cells.",
+				DefaultValue: defaultGridKm,
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			area, err := coverageArea(p.Args)
+			if err != nil {
+				return nil, err
+			}
+
+			maxDistanceKm, _ := p.Args["maxDistanceKm"].(float64)
+			gridKm, ok := p.Args["gridKm"].(float64)
+			if !ok {
+				gridKm = defaultGridKm
+			}
+
+			return location.CoverageGaps(area, maxDistanceKm, gridKm)
+		},
+	})
+}
+
+// coverageArea reads the polygon, or the bounding box, of the arguments.
+func coverageArea(args map[string]interface{}) ([]spatial.Point, error) {
+	if polygon, ok := args["polygon"].([]interface{}); ok {
+		area := []spatial.Point{}
+		for _, v := range polygon {
+			point, _ := v.([]interface{})
+			if len(point) != 2 {
+				return nil, location.ErrInvalidArea
+			}
+
+			lat, latOk := point[0].(float64)
+			lng, lngOk := point[1].(float64)
+			if !latOk || !lngOk {
+				return nil, location.ErrInvalidArea
+			}
+
+			p := spatial.Point{Lat: lat, Lng: lng}
+			err := location.CheckPoint(p)
+			if err != nil {
+				return nil, err
+			}
+			area = append(area, p)
+		}
+		return area, nil
+	}
+
+	bb, _ := args["boundingBox"].([]interface{})
+	if len(bb) != 4 {
+		return nil, location.ErrInvalidArea
+	}
+
+	coords := []float64{}
+	for _, v := range bb {
+		f, ok := v.(float64)
+		if !ok {
+			return nil, location.ErrInvalidArea
+		}
+		coords = append(coords, f)
+	}
+
+	nw := spatial.Point{Lat: coords[0], Lng: coords[1]}
+	se := spatial.Point{Lat: coords[2], Lng: coords[3]}
+	for _, p := range []spatial.Point{nw, se} {
+		err := location.CheckPoint(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return location.BoundingBox(nw, se), nil
+}
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/dewski/spatial"
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+func TestCoverageAreaFromBoundingBox(t *testing.T) {
+	area, err := coverageArea(map[string]interface{}{
+		"boundingBox": []interface{}{10.0, 0.0, 0.0, 10.0},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, location.BoundingBox(spatial.Point{Lat: 10, Lng: 0}, spatial.Point{Lat: 0, Lng: 10}), area)
+}
+
+func TestCoverageAreaFromPolygon(t *testing.T) {
+	area, err := coverageArea(map[string]interface{}{
+		"boundingBox": []interface{}{10.0, 0.0, 0.0, 10.0},
+		"polygon": []interface{}{
+			[]interface{}{0.0, 0.0},
+			[]interface{}{5.0, 5.0},
+			[]interface{}{0.0, 10.0},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []spatial.Point{{Lat: 0, Lng: 0}, {Lat: 5, Lng: 5}, {Lat: 0, Lng: 10}}, area)
+}
+
+func TestCoverageAreaInvalid(t *testing.T) {
+	_, err := coverageArea(map[string]interface{}{})
+	assert.Equal(t, location.ErrInvalidArea, err)
+
+	_, err = coverageArea(map[string]interface{}{"boundingBox": []interface{}{1.0, 2.0}})
+	assert.Equal(t, location.ErrInvalidArea, err)
+
+	_, err = coverageArea(map[string]interface{}{"polygon": []interface{}{[]interface{}{1.0}}})
+	assert.Equal(t, location.ErrInvalidArea, err)
+
+	_, err = coverageArea(map[string]interface{}{"boundingBox": []interface{}{91.0, 0.0, 0.0, 10.0}})
+	assert.Equal(t, location.ErrInvalidLatitude, err)
+
+	_, err = coverageArea(map[string]interface{}{"polygon": []interface{}{
+		[]interface{}{0.0, 0.0},
+		[]interface{}{5.0, -200.0},
+		[]interface{}{0.0, 10.0},
+	}})
+	assert.Equal(t, location.ErrInvalidLongitude, err)
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo"
+)
+
+// drain counts the requests in flight so shutting down can wait for them.
+// Requests may still arrive on open connections while it waits.
+type drain struct {
+	sync.Mutex
+	requests int
+	stopping bool
+	idle     chan struct{}
+}
+
+func newDrain() *drain {
+	return &drain{idle: make(chan struct{})}
+}
+
+// track counts each request but subscriptions, which last as long as their
+// client and are dropped on shutdown.
+func (d *drain) track(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if strings.EqualFold(c.Request().Header().Get("Upgrade"), "websocket") {
+			return next(c)
+		}
+
+		d.start()
+		defer d.finish()
+		return next(c)
+	}
+}
+
+func (d *drain) start() {
+	d.Lock()
+	defer d.Unlock()
+
+	d.requests++
+}
+
+func (d *drain) finish() {
+	d.Lock()
+	defer d.Unlock()
+
+	d.requests--
+	d.closeIfIdle()
+}
+
+// wait returns a channel closed once no request is in flight.
+func (d *drain) wait() <-chan struct{} {
+	d.Lock()
+	defer d.Unlock()
+
+	d.stopping = true
+	d.closeIfIdle()
+	return d.idle
+}
+
+func (d *drain) closeIfIdle() {
+	if !d.stopping || d.requests > 0 {
+		return
+	}
+
+	select {
+	case <-d.idle:
+	default:
+		close(d.idle)
+	}
+}
@@ -0,0 +1,47 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func closed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestDrainWaitsForRequestsInFlight(t *testing.T) {
+	d := newDrain()
+	d.start()
+	d.start()
+
+	idle := d.wait()
+	assert.False(t, closed(idle))
+
+	d.finish()
+	assert.False(t, closed(idle))
+
+	// A request arriving on an open connection while draining
+	d.start()
+	d.finish()
+	assert.False(t, closed(idle))
+
+	d.finish()
+	assert.True(t, closed(idle))
+
+	d.start()
+	d.finish()
+	assert.True(t, closed(d.wait()))
+}
+
+func TestDrainIdleWithoutRequests(t *testing.T) {
+	d := newDrain()
+	d.start()
+	d.finish()
+	assert.True(t, closed(d.wait()))
+}
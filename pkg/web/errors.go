@@ -0,0 +1,171 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	gqllocation "github.com/graphql-go/graphql/language/location"
+	"github.com/lib/pq"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"golang.org/x/net/context"
+)
+
+// The codes in the extensions of errors, clients may rely on them not
+// changing. They're documented by the ErrorCode enum of the schema.
+const (
+	codeBadUserInput               = apierror.BadUserInput
+	codeNotFound                   = apierror.NotFound
+	codeForbidden                  = apierror.Forbidden
+	codeRateLimited                = "RATE_LIMITED"
+	codeInternal                   = "INTERNAL"
+	codeQueryTooComplex            = "QUERY_TOO_COMPLEX"
+	codePersistedQueryNotFound     = "PERSISTED_QUERY_NOT_FOUND"
+	codePersistedQueryNotAllowed   = "PERSISTED_QUERY_NOT_ALLOWED"
+	codePersistedQueryNotSupported = "PERSISTED_QUERY_NOT_SUPPORTED"
+)
+
+// pqTooManyConnections is the Postgres error code when the database refuses
+// new connections.
+const pqTooManyConnections = "53300"
+
+var ErrRateLimited = &requestError{"Too many requests right now, try again shortly", codeRateLimited, nil}
+
+var enumErrorCode = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "ErrorCode",
+	Description: "The code in the extensions of each error of a response.",
+	Values: graphql.EnumValueConfigMap{
+		codeBadUserInput: &graphql.EnumValueConfig{
+			Value:       codeBadUserInput,
+			Description: "The query, its variables or arguments are invalid, retrying won't help.",
+		},
+		codeNotFound: &graphql.EnumValueConfig{
+			Value:       codeNotFound,
+			Description: "An object that was asked for by ID doesn't exist.",
+		},
+		codeForbidden: &graphql.EnumValueConfig{
+			Value:       codeForbidden,
+			Description: "The field needs an admin token.",
+		},
+		codeRateLimited: &graphql.EnumValueConfig{
+			Value:       codeRateLimited,
+			Description: "The server is too busy to answer, retry later.",
+		},
+		codeInternal: &graphql.EnumValueConfig{
+			Value:       codeInternal,
+			Description: "Something went wrong on our side, the message has a request ID to quote when reporting it.",
+		},
+		codeQueryTooComplex: &graphql.EnumValueConfig{
+			Value:       codeQueryTooComplex,
+			Description: "The query is over the depth, alias or cost limits, its cost is in the extensions of the response.",
+		},
+		codePersistedQueryNotFound: &graphql.EnumValueConfig{
+			Value:       codePersistedQueryNotFound,
+			Description: "The hash of a persisted query is unknown, send it again along with the query.",
+		},
+		codePersistedQueryNotAllowed: &graphql.EnumValueConfig{
+			Value:       codePersistedQueryNotAllowed,
+			Description: "Only registered persisted queries are accepted.",
+		},
+		codePersistedQueryNotSupported: &graphql.EnumValueConfig{
+			Value:       codePersistedQueryNotSupported,
+			Description: "Queries aren't automatically persisted, send the query itself.",
+		},
+	},
+})
+
+// responseError is an error as it's encoded in a response.
+type responseError struct {
+	Message    string                       `json:"message"`
+	Locations  []gqllocation.SourceLocation `json:"locations,omitempty"`
+	Path       []interface{}                `json:"path,omitempty"`
+	Extensions errorExtensions              `json:"extensions"`
+}
+
+type errorExtensions struct {
+	Code string `json:"code"`
+}
+
+// codeCarrier is an error that's safe to show along with its code, like the
+// errors of apierror.
+type codeCarrier interface {
+	error
+	Code() string
+}
+
+// codedError returns err with its code. Errors that don't carry a code aren't
+// known to be safe to show, they're logged and replaced by one that refers to the request instead.
+func codedError(ctx context.Context, err error) *requestError {
+	switch e := err.(type) {
+	case *requestError:
+		return e
+	case *pq.Error:
+		if e.Code == pqTooManyConnections {
+			return ErrRateLimited
+		}
+	}
+
+	if e, ok := err.(codeCarrier); ok {
+		return &requestError{e.Error(), e.Code(), nil}
+	}
+
+	id := requestIDFrom(ctx)
+	fmt.Printf("Internal error in request %s: %v\n", id, err)
+	return &requestError{fmt.Sprintf("Internal error, quote request %s when reporting it", id), codeInternal, nil}
+}
+
+// withErrorCodes wraps the resolvers of fields so they fail with a coded
+// error, which is remembered for the response as the executor only keeps its
+// message.
+func withErrorCodes(fields graphql.Fields) graphql.Fields {
+	for _, field := range fields {
+		resolve := field.Resolve
+		if resolve == nil {
+			continue
+		}
+
+		field.Resolve = func(p graphql.ResolveParams) (interface{}, error) {
+			v, err := resolve(p)
+			if err != nil {
+				coded := codedError(p.Context, err)
+				if errs := fieldErrorsFrom(p.Context); errs != nil {
+					errs.Lock()
+					errs.failed = coded
+					errs.Unlock()
+				}
+				return nil, coded
+			}
+
+			return v, nil
+		}
+	}
+
+	return fields
+}
+
+// requestID returns the ID Heroku's router gave r, or a new one.
+func requestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-Id")
+	if id != "" && len(id) <= 200 {
+		return id
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return "unknown"
+	}
+
+	id, ok := ctx.Value(requestIDContextKey).(string)
+	if !ok {
+		return "unknown"
+	}
+
+	return id
+}
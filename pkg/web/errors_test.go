@@ -0,0 +1,81 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/handler"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/location"
+	"golang.org/x/net/context"
+)
+
+func TestCodedError(t *testing.T) {
+	ctx := context.WithValue(context.Background(), requestIDContextKey, "abc123")
+
+	coded := codedError(ctx, location.ErrInvalidLatitude)
+	assert.Equal(t, "Invalid latitude", coded.message)
+	assert.Equal(t, codeBadUserInput, coded.code)
+
+	assert.Equal(t, codeNotFound, codedError(ctx, location.ErrNotFound).code)
+	assert.Equal(t, codeNotFound, codedError(ctx, notFound("nid", 1)).code)
+	assert.Equal(t, codeForbidden, codedError(ctx, ErrAdminRequired).code)
+	assert.Equal(t, codeBadUserInput, codedError(ctx, ErrNotSubscription).code)
+	assert.Equal(t, codeBadUserInput, codedError(ctx, apierror.New(apierror.BadUserInput, "Nope")).code)
+	assert.Equal(t, ErrRateLimited, codedError(ctx, &pq.Error{Code: pqTooManyConnections}))
+
+	coded = codedError(ctx, errors.New(`pq: relation "locations" does not exist`))
+	assert.Equal(t, codeInternal, coded.code)
+	assert.Equal(t, "Internal error, quote request abc123 when reporting it", coded.message)
+}
+
+func TestRequestID(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/graphql", nil)
+	assert.Len(t, requestID(r), 16)
+
+	r.Header.Set("X-Request-Id", "f9ed4675-f2c6-4d7a-b6a4-3b2c5a1b8c3d")
+	assert.Equal(t, "f9ed4675-f2c6-4d7a-b6a4-3b2c5a1b8c3d", requestID(r))
+}
+
+func TestGraphQLHandlerCodesErrors(t *testing.T) {
+	var err error
+	Schema, err = BuildSchema()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	defer server.Close()
+
+	for query, code := range map[string]string{
+		`{ location { title } }`: codeBadUserInput,
+		`{ webhooks { url } }`:   codeForbidden,
+		`{ unknownField }`:       codeBadUserInput,
+	} {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		res, err := http.Post(server.URL, "application/json", strings.NewReader(string(body)))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.Header.Get("X-Request-Id"))
+
+		response := struct {
+			Errors []responseError
+		}{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+		res.Body.Close()
+
+		assert.Len(t, response.Errors, 1, query)
+		assert.Equal(t, code, response.Errors[0].Extensions.Code, query)
+	}
+}
+
+func TestSchemaDocumentsErrorCodes(t *testing.T) {
+	schema, err := BuildSchema()
+	assert.NoError(t, err)
+
+	codes := schema.Type("ErrorCode")
+	assert.NotNil(t, codes)
+}
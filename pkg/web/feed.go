@@ -0,0 +1,254 @@
+package web
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/labstack/echo"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+const (
+	feedLimit    = 50
+	feedIDPrefix = "tag:superchargers.io,2016:"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Summary    string         `xml:"summary"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+}
+
+// feedKind is one of the feeds served under /feeds.
+type feedKind struct {
+	Name  string
+	Title string
+	Query func(location.FeedFilter, int) ([]*location.Location, error)
+	// Time returns when the location entered the feed.
+	Time func(*location.Location) time.Time
+}
+
+var feedKinds = []feedKind{
+	{
+		Name:  "opened",
+		Title: "Recently opened",
+		Query: location.Opened,
+		Time: func(l *location.Location) time.Time {
+			return l.OpenedTime()
+		},
+	},
+	{
+		Name:  "announced",
+		Title: "Recently announced",
+		Query: location.Announced,
+		Time: func(l *location.Location) time.Time {
+			return l.CreatedAt
+		},
+	},
+}
+
+func registerFeeds(e *echo.Echo) {
+	for _, kind := range feedKinds {
+		e.Get(fmt.Sprintf("/feeds/%s.atom", kind.Name), feedHandler(kind))
+		e.Get(fmt.Sprintf("/feeds/countries/:country/%s.atom", kind.Name), feedHandler(kind))
+		e.Get(fmt.Sprintf("/feeds/regions/:region/%s.atom", kind.Name), feedHandler(kind))
+	}
+}
+
+// feedHandler serves an Atom feed of the kind, narrowed by the :country or
+// :region path parameters. Requests with a matching If-None-Match or
+// If-Modified-Since get a 304.
+func feedHandler(kind feedKind) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter := location.FeedFilter{}
+		title := kind.Title + " Tesla locations"
+
+		if slug := c.Param("country"); slug != "" {
+			country, ok := enumValueForSlug(enumCountry, slug)
+			if !ok {
+				return echo.ErrNotFound
+			}
+			filter.Country = country
+			title = fmt.Sprintf("%s in %s", title, country)
+		}
+
+		if slug := c.Param("region"); slug != "" {
+			region, ok := enumValueForSlug(enumRegion, slug)
+			if !ok {
+				return echo.ErrNotFound
+			}
+			filter.Region = region
+			title = fmt.Sprintf("%s in %s", title, strings.Title(strings.Replace(region, "_", " ", -1)))
+		}
+
+		locations, err := kind.Query(filter, feedLimit)
+		if err != nil {
+			return err
+		}
+
+		req := c.Request()
+		path := req.URL().Path()
+		self := requestScheme(req.Header().Get("X-Forwarded-Proto")) + "://" + req.Host() + path
+		feed := buildFeed(kind, title, path, self, locations)
+
+		body, err := xml.MarshalIndent(feed, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		updated, _ := time.Parse(time.RFC3339, feed.Updated)
+		sum := sha1.Sum(body)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+		res := c.Response()
+		res.Header().Set("ETag", etag)
+		res.Header().Set(echo.HeaderLastModified, updated.UTC().Format(http.TimeFormat))
+		res.Header().Set("Cache-Control", "public, max-age=300")
+
+		if notModified(req.Header().Get("If-None-Match"), req.Header().Get(echo.HeaderIfModifiedSince), etag, updated) {
+			return c.NoContent(http.StatusNotModified)
+		}
+
+		return c.Blob(http.StatusOK, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), body...))
+	}
+}
+
+// buildFeed identifies the feed by its path and each entry by the feed kind
+// and the location's global ID, so IDs are stable across hosts and syncs.
+func buildFeed(kind feedKind, title string, path string, self string, locations []*location.Location) atomFeed {
+	feed := atomFeed{
+		ID:    feedIDPrefix + path,
+		Title: title,
+		Author: atomAuthor{
+			Name: "Superchargers.io",
+			URI:  "https://www.superchargers.io",
+		},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: "https://www.superchargers.io"},
+		},
+		Entries: []atomEntry{},
+	}
+
+	// An empty feed is as old as the epoch so it is still cacheable.
+	updated := time.Unix(0, 0).UTC()
+	for _, l := range locations {
+		at := kind.Time(l).UTC()
+		if at.After(updated) {
+			updated = at
+		}
+
+		entry := atomEntry{
+			ID:        fmt.Sprintf("%s%s/%s", feedIDPrefix, kind.Name, l.ToGlobalID()),
+			Title:     l.Title,
+			Updated:   at.Format(time.RFC3339),
+			Published: at.Format(time.RFC3339),
+			Summary:   feedSummary(l),
+		}
+
+		if l.DirectionsLink != nil && *l.DirectionsLink != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "related", Href: *l.DirectionsLink})
+		}
+
+		for _, t := range l.LocationType {
+			entry.Categories = append(entry.Categories, atomCategory{Term: t})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+	feed.Updated = updated.Format(time.RFC3339)
+
+	return feed
+}
+
+func feedSummary(l *location.Location) string {
+	parts := []string{l.Address, l.City}
+	if l.ProvinceState != nil && *l.ProvinceState != "" {
+		parts = append(parts, *l.ProvinceState)
+	}
+	parts = append(parts, l.Country)
+
+	summary := strings.Join(parts, ", ")
+	if l.Chargers != nil && *l.Chargers != "" {
+		summary += ". " + *l.Chargers
+	}
+	return summary
+}
+
+// notModified reports whether the client's cached copy is current, an
+// If-None-Match header takes precedence over If-Modified-Since.
+func notModified(ifNoneMatch string, ifModifiedSince string, etag string, updated time.Time) bool {
+	if ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err == nil && !updated.Truncate(time.Second).After(since) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enumValueForSlug maps slugs such as united-states to the value of the
+// UNITED_STATES enum.
+func enumValueForSlug(enum *graphql.Enum, slug string) (string, bool) {
+	name := strings.ToUpper(strings.Replace(slug, "-", "_", -1))
+	for _, v := range enum.Values() {
+		if v.Name == name {
+			value, ok := v.Value.(string)
+			return value, ok
+		}
+	}
+	return "", false
+}
+
+func requestScheme(proto string) string {
+	if isDyno || proto == "https" {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/location"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+func TestBuildFeed(t *testing.T) {
+	created := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	opened := time.Date(2016, 11, 2, 8, 30, 0, 0, time.UTC)
+	locations := []*location.Location{
+		{
+			ID:        12,
+			OpenedAt:  &opened,
+			CreatedAt: created,
+			Supercharger: supercharger.Supercharger{
+				Title:        "Barstow, CA",
+				Address:      "2812 Lenwood Rd",
+				City:         "Barstow",
+				Country:      "United States",
+				LocationType: supercharger.LocationList{"supercharger"},
+			},
+		},
+		{ID: 13, CreatedAt: created},
+	}
+
+	feed := buildFeed(feedKinds[0], "Opened", "/feeds/opened.atom", "https://www.superchargers.io/feeds/opened.atom", locations)
+
+	assert.Equal(t, "tag:superchargers.io,2016:/feeds/opened.atom", feed.ID)
+	assert.Equal(t, "2016-11-02T08:30:00Z", feed.Updated)
+	assert.Len(t, feed.Entries, 2)
+
+	entry := feed.Entries[0]
+	assert.Equal(t, "tag:superchargers.io,2016:opened/TG9jYXRpb246MTI=", entry.ID)
+	assert.Equal(t, "2016-11-02T08:30:00Z", entry.Updated)
+	assert.Equal(t, "2812 Lenwood Rd, Barstow, United States", entry.Summary)
+	assert.Equal(t, []atomCategory{{Term: "supercharger"}}, entry.Categories)
+
+	// Locations without opened_at fall back to when they were first seen
+	assert.Equal(t, "2016-10-01T12:00:00Z", feed.Entries[1].Updated)
+}
+
+func TestBuildEmptyFeed(t *testing.T) {
+	feed := buildFeed(feedKinds[1], "Announced", "/feeds/announced.atom", "http://localhost/feeds/announced.atom", nil)
+	assert.Equal(t, "1970-01-01T00:00:00Z", feed.Updated)
+	assert.Empty(t, feed.Entries)
+}
+
+func TestNotModified(t *testing.T) {
+	updated := time.Date(2016, 11, 2, 8, 30, 0, 0, time.UTC)
+	etag := `"abc"`
+
+	assert.False(t, notModified("", "", etag, updated))
+	assert.True(t, notModified(`"abc"`, "", etag, updated))
+	assert.True(t, notModified(`"xyz", W/"abc"`, "", etag, updated))
+	assert.False(t, notModified(`"xyz"`, updated.Format(http.TimeFormat), etag, updated))
+
+	assert.True(t, notModified("", updated.Format(http.TimeFormat), etag, updated))
+	assert.False(t, notModified("", updated.Add(-time.Hour).Format(http.TimeFormat), etag, updated))
+}
+
+func TestEnumValueForSlug(t *testing.T) {
+	country, ok := enumValueForSlug(enumCountry, "united-states")
+	assert.True(t, ok)
+	assert.Equal(t, "United States", country)
+
+	region, ok := enumValueForSlug(enumRegion, "north-america")
+	assert.True(t, ok)
+	assert.Equal(t, "north_america", region)
+
+	_, ok = enumValueForSlug(enumCountry, "atlantis")
+	assert.False(t, ok)
+}
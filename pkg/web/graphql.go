@@ -1,11 +1,12 @@
 package web
 
 import (
-	"errors"
-	"strconv"
+	"fmt"
+	"time"
 
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/relay"
+	"github.com/wattapp/superchargers/pkg/country"
 	"github.com/wattapp/superchargers/pkg/database"
 	"github.com/wattapp/superchargers/pkg/location"
 	"github.com/wattapp/superchargers/pkg/supercharger"
@@ -18,6 +19,7 @@ var nodeDefinitions *relay.NodeDefinitions
 var locationType *graphql.Object
 var emailType *graphql.Object
 var phoneType *graphql.Object
+var syncRunType *graphql.Object
 
 // Custom node field types
 var enumLocationType = graphql.NewEnum(graphql.EnumConfig{
@@ -41,116 +43,40 @@ var enumLocationType = graphql.NewEnum(graphql.EnumConfig{
 	},
 })
 
-var enumRegion = graphql.NewEnum(graphql.EnumConfig{
-	Name: "Region",
+var enumLocationEvent = graphql.NewEnum(graphql.EnumConfig{
+	Name: "LocationEvent",
 	Values: graphql.EnumValueConfigMap{
-		"NORTH_AMERICA": &graphql.EnumValueConfig{
-			Value: "north_america",
+		"ADDED": &graphql.EnumValueConfig{
+			Value: location.EventAdded,
 		},
-		"EUROPE": &graphql.EnumValueConfig{
-			Value: "europe",
+		"UPDATED": &graphql.EnumValueConfig{
+			Value: location.EventUpdated,
 		},
-		"ASIA_PACIFIC": &graphql.EnumValueConfig{
-			Value: "asia_pacific",
+		"REMOVED": &graphql.EnumValueConfig{
+			Value: location.EventRemoved,
+		},
+		"OPENED": &graphql.EnumValueConfig{
+			Value:       location.EventOpened,
+			Description: "A location that was opening soon has opened.",
 		},
 	},
 })
 
-var enumCountry = graphql.NewEnum(graphql.EnumConfig{
-	Name: "Country",
+var enumSyncRunStatus = graphql.NewEnum(graphql.EnumConfig{
+	Name: "SyncRunStatus",
 	Values: graphql.EnumValueConfigMap{
-		"ANDORRA": &graphql.EnumValueConfig{
-			Value: "Andorra",
-		},
-		"AUSTRALIA": &graphql.EnumValueConfig{
-			Value: "Australia",
-		},
-		"AUSTRIA": &graphql.EnumValueConfig{
-			Value: "Austria",
-		},
-		"BELGIUM": &graphql.EnumValueConfig{
-			Value: "Belgium",
-		},
-		"CANADA": &graphql.EnumValueConfig{
-			Value: "Canada",
-		},
-		"CHINA": &graphql.EnumValueConfig{
-			Value: "China",
-		},
-		"CROATIA": &graphql.EnumValueConfig{
-			Value: "Croatia",
-		},
-		"CZECH_REPUBLIC": &graphql.EnumValueConfig{
-			Value: "Czech Republic",
-		},
-		"DENMARK": &graphql.EnumValueConfig{
-			Value: "Denmark",
-		},
-		"FINLAND": &graphql.EnumValueConfig{
-			Value: "Finland",
-		},
-		"FRANCE": &graphql.EnumValueConfig{
-			Value: "France",
-		},
-		"GERMANY": &graphql.EnumValueConfig{
-			Value: "Germany",
-		},
-		"HONG_KONG": &graphql.EnumValueConfig{
-			Value: "Hong Kong",
-		},
-		"ITALY": &graphql.EnumValueConfig{
-			Value: "Italy",
-		},
-		"JAPAN": &graphql.EnumValueConfig{
-			Value: "Japan",
-		},
-		"LIECHTENSTEIN": &graphql.EnumValueConfig{
-			Value: "Liechtenstein",
-		},
-		"LUXEMBOURG": &graphql.EnumValueConfig{
-			Value: "Luxembourg",
-		},
-		"MACAU": &graphql.EnumValueConfig{
-			Value: "Macau",
-		},
-		"MEXICO": &graphql.EnumValueConfig{
-			Value: "Mexico",
-		},
-		"NETHERLANDS": &graphql.EnumValueConfig{
-			Value: "Netherlands",
-		},
-		"NORWAY": &graphql.EnumValueConfig{
-			Value: "Norway",
-		},
-		"POLAND": &graphql.EnumValueConfig{
-			Value: "Poland",
-		},
-		"SERBIA": &graphql.EnumValueConfig{
-			Value: "Serbia",
-		},
-		"SLOVAKIA": &graphql.EnumValueConfig{
-			Value: "Slovakia",
-		},
-		"SLOVENIA": &graphql.EnumValueConfig{
-			Value: "Slovenia",
-		},
-		"SPAIN": &graphql.EnumValueConfig{
-			Value: "Spain",
-		},
-		"SWEDEN": &graphql.EnumValueConfig{
-			Value: "Sweden",
-		},
-		"SWITZERLAND": &graphql.EnumValueConfig{
-			Value: "Switzerland",
+		"RUNNING": &graphql.EnumValueConfig{
+			Value: location.SyncRunRunning,
 		},
-		"TAIWAN": &graphql.EnumValueConfig{
-			Value: "Taiwan",
+		"SUCCEEDED": &graphql.EnumValueConfig{
+			Value: location.SyncRunSucceeded,
 		},
-		"UNITED_KINGDOM": &graphql.EnumValueConfig{
-			Value: "United Kingdom",
+		"FAILED": &graphql.EnumValueConfig{
+			Value: location.SyncRunFailed,
 		},
-		"UNITED_STATES": &graphql.EnumValueConfig{
-			Value: "United States",
+		"BLOCKED": &graphql.EnumValueConfig{
+			Value:       location.SyncRunBlocked,
+			Description: "The sync changed too many locations and is waiting for manual approval.",
 		},
 	},
 })
@@ -166,6 +92,10 @@ var locationFieldArguments = relay.NewConnectionArgs(graphql.FieldConfigArgument
 	"country": &graphql.ArgumentConfig{
 		Type: graphql.NewList(enumCountry),
 	},
+	"countryCode": &graphql.ArgumentConfig{
+		Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+		Description: "ISO 3166-1 alpha-2 or alpha-3 codes of countries, such as US or DEU.",
+	},
 	"openSoon": &graphql.ArgumentConfig{
 		Type:        graphql.Boolean,
 		Description: "Whether or not the location is opening soon.",
@@ -180,18 +110,31 @@ var locationFieldArguments = relay.NewConnectionArgs(graphql.FieldConfigArgument
 	},
 })
 
+// mergeFields combines the fields of a type defined in several places, a
+// field defined twice is a mistake.
+func mergeFields(fieldsList ...graphql.Fields) graphql.Fields {
+	merged := graphql.Fields{}
+	for _, fields := range fieldsList {
+		for name, field := range fields {
+			if _, ok := merged[name]; ok {
+				panic(fmt.Sprintf("Field %s is defined twice", name))
+			}
+			merged[name] = field
+		}
+	}
+
+	return merged
+}
+
 func BuildSchema() (graphql.Schema, error) {
 	nodeDefinitions = relay.NewNodeDefinitions(relay.NodeDefinitionsConfig{
 		IDFetcher: func(id string, info graphql.ResolveInfo, ctx context.Context) (interface{}, error) {
-			resolvedID := relay.FromGlobalID(id)
-
-			switch resolvedID.Type {
-			case "Location":
-				locationID, _ := strconv.ParseInt(resolvedID.ID, 10, 64)
-				return location.GetLocation(locationID)
-			default:
-				return nil, errors.New("Unknown node type")
+			n, err := locationID(id)
+			if err != nil {
+				return nil, err
 			}
+
+			return location.LoaderFrom(ctx).GetLocation(n)
 		},
 		TypeResolve: func(p graphql.ResolveTypeParams) *graphql.Object {
 			switch p.Value.(type) {
@@ -330,6 +273,18 @@ func BuildSchema() (graphql.Schema, error) {
 					return l.Country, nil
 				},
 			},
+			"countryCode": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The ISO 3166-1 alpha-2 code of the country.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					l := p.Source.(*location.Location)
+					c, ok := country.ByName(l.Country)
+					if !ok {
+						return nil, nil
+					}
+					return c.Alpha2, nil
+				},
+			},
 			"destinationChargerLogo": &graphql.Field{
 				Type:        graphql.String,
 				Description: "The URL for the logo of the operators of the destination charger.",
@@ -550,57 +505,222 @@ func BuildSchema() (graphql.Schema, error) {
 		},
 	})
 
-	queryType := graphql.NewObject(graphql.ObjectConfig{
-		Name: "Query",
+	syncRunType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "SyncRun",
+		Description: "A single update of the locations from Tesla.",
 		Fields: graphql.Fields{
-			"locations": &graphql.Field{
-				Type: graphql.NewList(locationType),
-				Args: locationFieldArguments,
+			"id": &graphql.Field{
+				Type: graphql.Int,
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					scope := database.NewGraphQLScopeWithFilters(p.Args)
-					scope.Limit = -1
-
-					locations, err := location.Locations(scope)
-					if err != nil {
-						return nil, err
+					r := p.Source.(*location.SyncRun)
+					return r.ID, nil
+				},
+			},
+			"status": &graphql.Field{
+				Type: enumSyncRunStatus,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					return r.Status, nil
+				},
+			},
+			"source": &graphql.Field{
+				Type:        graphql.String,
+				Description: "What started the sync.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					return r.Source, nil
+				},
+			},
+			"snapshotHash": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The SHA-256 fingerprint of the locations received from Tesla.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					if r.SnapshotHash == nil {
+						return nil, nil
 					}
-
-					return locations, nil
+					return *r.SnapshotHash, nil
+				},
+			},
+			"added": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					return r.Added, nil
+				},
+			},
+			"updated": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					return r.Updated, nil
+				},
+			},
+			"unchanged": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					return r.Unchanged, nil
+				},
+			},
+			"removed": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					return r.Removed, nil
+				},
+			},
+			"error": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Why the sync failed or was blocked.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					if r.Error == nil {
+						return nil, nil
+					}
+					return *r.Error, nil
 				},
 			},
-			"near": &graphql.Field{
-				Type: graphql.NewList(locationType),
-				Args: relay.NewConnectionArgs(graphql.FieldConfigArgument{
-					"latitude": &graphql.ArgumentConfig{
-						Type:        graphql.NewNonNull(graphql.Float),
-						Description: "The latitude of the coordinate.",
+			"startedAt": &graphql.Field{
+				Type:        graphql.String,
+				Description: "When the sync started as an RFC 3339 timestamp.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					return r.StartedAt.Format(time.RFC3339), nil
+				},
+			},
+			"finishedAt": &graphql.Field{
+				Type:        graphql.String,
+				Description: "When the sync finished as an RFC 3339 timestamp, null while it is running.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := p.Source.(*location.SyncRun)
+					if r.FinishedAt == nil {
+						return nil, nil
+					}
+					return r.FinishedAt.Format(time.RFC3339), nil
+				},
+			},
+		},
+	})
+
+	buildWebhookTypes()
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: withCosts("Query", withErrorCodes(mergeFields(
+			graphql.Fields{
+				// Without first or last every location is loaded
+				"locations": costly(fieldCost{Weight: 1, DefaultSize: 1000}, &graphql.Field{
+					Type: graphql.NewList(locationType),
+					Args: locationFieldArguments,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						scope := database.NewGraphQLScopeWithFilters(p.Args)
+						scope.Limit = -1
+
+						locations, err := location.LoaderFrom(p.Context).Locations(scope)
+						if err != nil {
+							return nil, err
+						}
+
+						return locations, nil
 					},
-					"longitude": &graphql.ArgumentConfig{
-						Type:        graphql.NewNonNull(graphql.Float),
-						Description: "The longitude of the coordinate.",
+				}),
+				"near": costly(fieldCost{Weight: 1, DefaultSize: database.DefaultLimit}, &graphql.Field{
+					Type: graphql.NewList(locationType),
+					Args: relay.NewConnectionArgs(graphql.FieldConfigArgument{
+						"latitude": &graphql.ArgumentConfig{
+							Type:        graphql.NewNonNull(graphql.Float),
+							Description: "The latitude of the coordinate.",
+						},
+						"longitude": &graphql.ArgumentConfig{
+							Type:        graphql.NewNonNull(graphql.Float),
+							Description: "The longitude of the coordinate.",
+						},
+						"type": &graphql.ArgumentConfig{
+							Type:        graphql.NewList(enumLocationType),
+							Description: "Each location may provide of 1 or many services such as supercharging, standard charging, destination charging, service, or a store.",
+						},
+					}),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						scope := database.NewGraphQLScopeWithFilters(p.Args)
+						scope.Limit = -1
+
+						locations, err := location.LoaderFrom(p.Context).Near(scope)
+						if err != nil {
+							return nil, err
+						}
+
+						return locations, nil
 					},
-					"type": &graphql.ArgumentConfig{
-						Type:        graphql.NewList(enumLocationType),
-						Description: "Each location may provide of 1 or many services such as supercharging, standard charging, destination charging, service, or a store.",
+				}),
+				"syncRuns": costly(fieldCost{Weight: 1, DefaultSize: 10}, &graphql.Field{
+					Type:        graphql.NewList(syncRunType),
+					Description: "The most recent updates of the locations from Tesla.",
+					Args: graphql.FieldConfigArgument{
+						"first": &graphql.ArgumentConfig{
+							Type:         graphql.Int,
+							DefaultValue: 10,
+						},
+						"status": &graphql.ArgumentConfig{
+							Type: graphql.NewList(enumSyncRunStatus),
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						first, _ := p.Args["first"].(int)
+						if first <= 0 || first > database.DefaultLimit {
+							first = database.DefaultLimit
+						}
+
+						var statuses []string
+						if p.Args["status"] != nil {
+							for _, s := range p.Args["status"].([]interface{}) {
+								statuses = append(statuses, s.(string))
+							}
+						}
+
+						return location.SyncRuns(first, statuses)
 					},
 				}),
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					scope := database.NewGraphQLScopeWithFilters(p.Args)
-					scope.Limit = -1
+				"lastSuccessfulSync": costly(fieldCost{Weight: 1}, &graphql.Field{
+					Type:        syncRunType,
+					Description: "The most recent successful update of the locations, use finishedAt to tell how fresh the data is.",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						run, err := location.LastSuccessfulSync()
+						if err != nil {
+							return nil, err
+						}
 
-					locations, err := location.Near(scope)
-					if err != nil {
-						return nil, err
-					}
+						if run == nil {
+							return nil, nil
+						}
 
-					return locations, nil
-				},
-			},
-			"node": nodeDefinitions.NodeField,
-		},
+						return run, nil
+					},
+				}),
+				"node":         costly(fieldCost{Weight: 1}, nodeDefinitions.NodeField),
+				"nodes":        nodesField(),
+				"stats":        statsField(),
+				"growth":       growthField(),
+				"search":       searchField(),
+				"coverageGaps": coverageGapsField(),
+				"autocomplete": autocompleteField(),
+			},
+			countryFields(),
+			locationLookupFields(),
+			networkFields(),
+			webhookQueryFields(),
+		))),
+	})
+
+	mutationType := graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Mutation",
+		Fields: withErrorCodes(webhookMutationFields()),
 	})
 
 	return graphql.NewSchema(graphql.SchemaConfig{
-		Query: queryType,
+		Query:        queryType,
+		Mutation:     mutationType,
+		Subscription: buildSubscriptionType(),
+		Types:        []graphql.Type{enumErrorCode},
 	})
 }
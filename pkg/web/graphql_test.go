@@ -0,0 +1,44 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSchema(t *testing.T) {
+	schema, err := BuildSchema()
+	assert.NoError(t, err)
+
+	fields := schema.QueryType().Fields()
+	assert.Contains(t, fields, "locations")
+	assert.Contains(t, fields, "near")
+	assert.Contains(t, fields, "node")
+	assert.Contains(t, fields, "syncRuns")
+	assert.Contains(t, fields, "lastSuccessfulSync")
+	assert.Contains(t, fields, "webhooks")
+	assert.Contains(t, fields, "countries")
+	assert.Contains(t, fields, "locationsByNid")
+	assert.Contains(t, fields, "reachable")
+
+	mutations := schema.MutationType().Fields()
+	assert.Contains(t, mutations, "createWebhook")
+	assert.Contains(t, mutations, "setWebhookActive")
+	assert.Contains(t, mutations, "deleteWebhook")
+
+	subscriptions := schema.SubscriptionType().Fields()
+	assert.Contains(t, subscriptions, "locationChanged")
+	assert.Contains(t, subscriptions, "syncCompleted")
+}
+
+func TestMergeFieldsRejectsDuplicates(t *testing.T) {
+	field := &graphql.Field{Type: graphql.String}
+
+	merged := mergeFields(graphql.Fields{"a": field}, graphql.Fields{"b": field})
+	assert.Len(t, merged, 2)
+
+	assert.Panics(t, func() {
+		mergeFields(graphql.Fields{"a": field}, graphql.Fields{"a": field})
+	})
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+var enumGrowthInterval = graphql.NewEnum(graphql.EnumConfig{
+	Name: "GrowthInterval",
+	Values: graphql.EnumValueConfigMap{
+		"DAY": &graphql.EnumValueConfig{
+			Value: location.GrowthDay,
+		},
+		"WEEK": &graphql.EnumValueConfig{
+			Value:       location.GrowthWeek,
+			Description: "Weeks start on Monday.",
+		},
+		"MONTH": &graphql.EnumValueConfig{
+			Value: location.GrowthMonth,
+		},
+		"QUARTER": &graphql.EnumValueConfig{
+			Value: location.GrowthQuarter,
+		},
+		"YEAR": &graphql.EnumValueConfig{
+			Value: location.GrowthYear,
+		},
+	},
+})
+
+var growthBucketType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "GrowthBucket",
+	Description: "The locations announced and opened within an interval.",
+	Fields: graphql.Fields{
+		"start": &graphql.Field{
+			Type:        graphql.String,
+			Description: "When the interval starts, in UTC.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(location.GrowthBucket).Start.Format(time.RFC3339), nil
+			},
+		},
+		"announced": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The number of locations first seen within the interval.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(location.GrowthBucket).Announced, nil
+			},
+		},
+		"opened": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The number of locations first seen open within the interval.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(location.GrowthBucket).Opened, nil
+			},
+		},
+		"cumulativeAnnounced": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The number of locations announced by the end of the interval.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(location.GrowthBucket).CumulativeAnnounced, nil
+			},
+		},
+		"cumulativeOpened": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The number of locations opened by the end of the interval.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(location.GrowthBucket).CumulativeOpened, nil
+			},
+		},
+	},
+})
+
+// growthField charts how the network grew from when locations were first
+// seen and first seen open, which archived snapshots may backfill.
+func growthField() *graphql.Field {
+	args := graphql.FieldConfigArgument{
+		"interval": &graphql.ArgumentConfig{
+			Type:         enumGrowthInterval,
+			DefaultValue: location.GrowthMonth,
+		},
+	}
+
+	for _, name := range []string{"type", "country", "countryCode", "region"} {
+		args[name] = locationFieldArguments[name]
+	}
+
+	return costly(fieldCost{Weight: 1, DefaultSize: 50}, &graphql.Field{
+		Type:        graphql.NewList(growthBucketType),
+		Description: "The locations announced and opened in each interval, oldest first. Removed locations aren't counted.",
+		Args:        args,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return location.Growth(intervalArgument(p.Args), database.NewGraphQLScopeWithFilters(p.Args))
+		},
+	})
+}
+
+// intervalArgument reads the interval argument, months when it's missing.
+func intervalArgument(args map[string]interface{}) string {
+	interval, _ := args["interval"].(string)
+	if interval == "" {
+		return location.GrowthMonth
+	}
+
+	return interval
+}
@@ -0,0 +1,13 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+func TestIntervalArgument(t *testing.T) {
+	assert.Equal(t, location.GrowthMonth, intervalArgument(map[string]interface{}{}))
+	assert.Equal(t, location.GrowthQuarter, intervalArgument(map[string]interface{}{"interval": location.GrowthQuarter}))
+}
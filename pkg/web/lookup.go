@@ -0,0 +1,112 @@
+package web
+
+import (
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+var ErrLocationLookup = apierror.New(apierror.BadUserInput, "Provide exactly one of nid, locationId or path")
+
+// locationLookupFields find locations by Tesla's identifiers rather than
+// their global IDs.
+func locationLookupFields() graphql.Fields {
+	return graphql.Fields{
+		"location": costly(fieldCost{Weight: 1}, &graphql.Field{
+			Type:        locationType,
+			Description: "Finds a location by exactly one of Tesla's identifiers.",
+			Args: graphql.FieldConfigArgument{
+				"nid": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Tesla's node ID of the location.",
+				},
+				"locationId": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Tesla's location ID, the oldest location is returned when several share it.",
+				},
+				"path": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "The path of the location's page on tesla.com, the oldest location is returned when several share it.",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if len(p.Args) != 1 {
+					return nil, ErrLocationLookup
+				}
+
+				var l *location.Location
+				var err error
+				for name, value := range p.Args {
+					switch name {
+					case "nid":
+						l, err = location.GetLocationByNid(int64(value.(int)))
+					case "locationId":
+						l, err = location.GetLocationByLocationID(value.(string))
+					case "path":
+						l, err = location.GetLocationByPath(value.(string))
+					}
+
+					if err == location.ErrNotFound {
+						return nil, notFound(name, value)
+					}
+				}
+
+				if err != nil {
+					return nil, err
+				}
+
+				return l, nil
+			},
+		}),
+		"locationsByNid": costly(fieldCost{Weight: 1}, &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(locationType)),
+			Description: "Finds locations by Tesla's node IDs, in the same order. Unknown node IDs are null and reported in errors.",
+			Args: graphql.FieldConfigArgument{
+				"nids": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.Int))),
+					Description: "Tesla's node IDs of locations, at most 100.",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				values, _ := p.Args["nids"].([]interface{})
+				if len(values) > maxNodes {
+					return nil, ErrTooManyIDs
+				}
+
+				nids := []int64{}
+				for _, value := range values {
+					nid, _ := value.(int)
+					nids = append(nids, int64(nid))
+				}
+
+				locations, err := location.LocationsByNid(nids)
+				if err != nil {
+					return nil, err
+				}
+
+				// Typed nils aren't null to the executor
+				results := make([]interface{}, len(locations))
+				for i, l := range locations {
+					if l == nil {
+						addFieldError(p.Context, p.Info, i, notFound("nid", nids[i]))
+						continue
+					}
+					results[i] = l
+				}
+
+				return results, nil
+			},
+		}),
+	}
+}
+
+// notFound describes the identifier that matched no location.
+func notFound(name string, value interface{}) error {
+	format := "No location with %s %v"
+	if _, ok := value.(string); ok {
+		format = "No location with %s %q"
+	}
+	return &requestError{fmt.Sprintf(format, name, value), codeNotFound, nil}
+}
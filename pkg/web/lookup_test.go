@@ -0,0 +1,45 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocationLookupRequiresOneIdentifier(t *testing.T) {
+	var err error
+	Schema, err = BuildSchema()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	defer server.Close()
+
+	for _, query := range []string{
+		`{ location { title } }`,
+		`{ location(nid: 1, path: "supercharger/x") { title } }`,
+	} {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		res, err := http.Post(server.URL, "application/json", strings.NewReader(string(body)))
+		assert.NoError(t, err)
+
+		response := struct {
+			Errors []responseError
+		}{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+		res.Body.Close()
+
+		assert.Len(t, response.Errors, 1)
+		assert.Equal(t, ErrLocationLookup.Error(), response.Errors[0].Message)
+		assert.Equal(t, codeBadUserInput, response.Errors[0].Extensions.Code)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	assert.EqualError(t, notFound("nid", int64(42)), "No location with nid 42")
+	assert.EqualError(t, notFound("path", "supercharger/x"), `No location with path "supercharger/x"`)
+}
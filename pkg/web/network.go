@@ -0,0 +1,115 @@
+package web
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/wattapp/superchargers/pkg/location"
+	"github.com/wattapp/superchargers/pkg/network"
+)
+
+var rangeKmArgument = &graphql.ArgumentConfig{
+	Type:        graphql.NewNonNull(graphql.Float),
+	Description: "How far apart, as the crow flies, two open Superchargers may be to be connected, at most 1000.",
+}
+
+// networkFields treat the open Superchargers as a graph connecting those
+// within range of each other.
+func networkFields() graphql.Fields {
+	componentType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "NetworkComponent",
+		Description: "Open Superchargers connected to each other within range.",
+		Fields: graphql.Fields{
+			"size": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "The number of Superchargers in the component.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return len(p.Source.(network.Component).Stations), nil
+				},
+			},
+			"locations": &graphql.Field{
+				Type:        graphql.NewList(locationType),
+				Description: "The Superchargers in the component.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return stationLocations(p, p.Source.(network.Component).Stations)
+				},
+			},
+			"bridges": &graphql.Field{
+				Type:        graphql.NewList(locationType),
+				Description: "The Superchargers whose removal would split the component.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return stationLocations(p, p.Source.(network.Component).Bridges)
+				},
+			},
+		},
+	})
+
+	return graphql.Fields{
+		"reachable": costly(fieldCost{Weight: 100, DefaultSize: 1000}, &graphql.Field{
+			Type:        graphql.NewList(locationType),
+			Description: "The open Superchargers that can be reached from a Supercharger by hopping between those within range of each other.",
+			Args: graphql.FieldConfigArgument{
+				"from": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.ID),
+					Description: "The ID of the open Supercharger to start from, which isn't returned.",
+				},
+				"rangeKm": rangeKmArgument,
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				from, err := locationID(p.Args["from"].(string))
+				if err != nil {
+					return nil, err
+				}
+
+				rangeKm, _ := p.Args["rangeKm"].(float64)
+				g, err := network.Load(rangeKm)
+				if err != nil {
+					return nil, err
+				}
+
+				stations, err := g.Reachable(from)
+				if err != nil {
+					return nil, err
+				}
+
+				return stationLocations(p, stations)
+			},
+		}),
+		"networkComponents": costly(fieldCost{Weight: 100, DefaultSize: 100}, &graphql.Field{
+			Type:        graphql.NewList(componentType),
+			Description: "The groups of open Superchargers connected within range, the largest first.",
+			Args: graphql.FieldConfigArgument{
+				"rangeKm": rangeKmArgument,
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				rangeKm, _ := p.Args["rangeKm"].(float64)
+				g, err := network.Load(rangeKm)
+				if err != nil {
+					return nil, err
+				}
+
+				return g.Components(), nil
+			},
+		}),
+	}
+}
+
+// stationLocations loads the locations of the stations in the same order.
+func stationLocations(p graphql.ResolveParams, stations []network.Station) ([]*location.Location, error) {
+	ids := []int64{}
+	for _, s := range stations {
+		ids = append(ids, s.ID)
+	}
+
+	found, err := location.LoaderFrom(p.Context).GetLocations(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	locations := []*location.Location{}
+	for _, l := range found {
+		if l != nil {
+			locations = append(locations, l)
+		}
+	}
+
+	return locations, nil
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/network"
+)
+
+func TestReachableValidatesArguments(t *testing.T) {
+	resolve := networkFields()["reachable"].Resolve
+
+	_, err := resolve(graphql.ResolveParams{Args: map[string]interface{}{
+		"from":    "nope",
+		"rangeKm": 250.0,
+	}})
+	assert.Equal(t, ErrInvalidID, err)
+
+	_, err = resolve(graphql.ResolveParams{Args: map[string]interface{}{
+		"from":    relay.ToGlobalID("Location", "1"),
+		"rangeKm": 0.0,
+	}})
+	assert.Equal(t, network.ErrInvalidRange, err)
+}
+
+func TestNetworkComponentsValidatesRange(t *testing.T) {
+	resolve := networkFields()["networkComponents"].Resolve
+
+	_, err := resolve(graphql.ResolveParams{Args: map[string]interface{}{"rangeKm": -1.0}})
+	assert.Equal(t, network.ErrInvalidRange, err)
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/relay"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+// maxNodes is the most IDs nodes accepts at once.
+const maxNodes = 100
+
+var (
+	ErrInvalidID   = apierror.New(apierror.BadUserInput, "Invalid ID")
+	ErrUnknownType = apierror.New(apierror.BadUserInput, "Unknown node type")
+	ErrTooManyIDs  = apierror.New(apierror.BadUserInput, "At most 100 IDs may be fetched at once")
+)
+
+// locationID returns the ID of the location a global ID refers to.
+func locationID(globalID string) (int64, error) {
+	resolved := relay.FromGlobalID(globalID)
+	if resolved == nil {
+		return 0, ErrInvalidID
+	}
+
+	if resolved.Type != "Location" {
+		return 0, ErrUnknownType
+	}
+
+	id, err := strconv.ParseInt(resolved.ID, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidID
+	}
+
+	return id, nil
+}
+
+// nodesField fetches many nodes with a single query, reporting an error for
+// each ID that's malformed or unknown.
+func nodesField() *graphql.Field {
+	return costly(fieldCost{Weight: 1}, &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(nodeDefinitions.NodeInterface)),
+		Description: "Fetches objects given their IDs, in the same order. Malformed or unknown IDs are null and reported in errors.",
+		Args: graphql.FieldConfigArgument{
+			"ids": &graphql.ArgumentConfig{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID))),
+				Description: "The IDs of objects, at most 100.",
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			ids, _ := p.Args["ids"].([]interface{})
+			if len(ids) > maxNodes {
+				return nil, ErrTooManyIDs
+			}
+
+			nodes := make([]interface{}, len(ids))
+			locationIDs := []int64{}
+			indexes := []int{}
+			for i, id := range ids {
+				globalID, _ := id.(string)
+				n, err := locationID(globalID)
+				if err != nil {
+					addFieldError(p.Context, p.Info, i, err)
+					continue
+				}
+
+				locationIDs = append(locationIDs, n)
+				indexes = append(indexes, i)
+			}
+
+			locations, err := location.LoaderFrom(p.Context).GetLocations(locationIDs)
+			if err != nil {
+				return nil, err
+			}
+
+			for j, l := range locations {
+				if l == nil {
+					addFieldError(p.Context, p.Info, indexes[j], location.ErrNotFound)
+					continue
+				}
+				nodes[indexes[j]] = l
+			}
+
+			return nodes, nil
+		},
+	})
+}
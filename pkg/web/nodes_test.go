@@ -0,0 +1,54 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/handler"
+	"github.com/graphql-go/relay"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocationID(t *testing.T) {
+	id, err := locationID(relay.ToGlobalID("Location", "42"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+
+	_, err = locationID("nope")
+	assert.Equal(t, ErrInvalidID, err)
+
+	_, err = locationID(relay.ToGlobalID("Location", "abc"))
+	assert.Equal(t, ErrInvalidID, err)
+
+	_, err = locationID(relay.ToGlobalID("SyncRun", "1"))
+	assert.Equal(t, ErrUnknownType, err)
+}
+
+func TestNodesReportsErrorsPerID(t *testing.T) {
+	var err error
+	Schema, err = BuildSchema()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	defer server.Close()
+
+	query := `{ found: nodes(ids: ["nope", "` + relay.ToGlobalID("SyncRun", "1") + `"]) { id } }`
+	body, _ := json.Marshal(map[string]string{"query": query})
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(string(body)))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	response := struct {
+		Data   map[string][]interface{}
+		Errors []responseError
+	}{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+	assert.Equal(t, []interface{}{nil, nil}, response.Data["found"])
+	assert.Equal(t, []responseError{
+		{Message: "Invalid ID", Path: []interface{}{"found", float64(0)}, Extensions: errorExtensions{Code: codeBadUserInput}},
+		{Message: "Unknown node type", Path: []interface{}{"found", float64(1)}, Extensions: errorExtensions{Code: codeBadUserInput}},
+	}, response.Errors)
+}
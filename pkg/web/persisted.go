@@ -0,0 +1,158 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/wattapp/superchargers/pkg/cache"
+)
+
+var (
+	ErrPersistedQueryNotFound     = &requestError{"PersistedQueryNotFound", codePersistedQueryNotFound, nil}
+	ErrPersistedQueryNotAllowed   = &requestError{"Only persisted queries are allowed", codePersistedQueryNotAllowed, nil}
+	ErrPersistedQueryNotSupported = &requestError{"PersistedQueryNotSupported", codePersistedQueryNotSupported, nil}
+	ErrPersistedQueryHashMismatch = &requestError{"The sha256Hash does not match the query", codeBadUserInput, nil}
+	ErrPersistedQueryVersion      = &requestError{"Unsupported persisted query version", codeBadUserInput, nil}
+)
+
+// persistedQueryExtension is the extension Apollo clients send to refer to a
+// query by its hash.
+type persistedQueryExtension struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+type queryExtensions struct {
+	PersistedQuery *persistedQueryExtension `json:"persistedQuery"`
+}
+
+// persistedQueries resolves queries sent by hash, from the registered queries
+// or those clients automatically persisted earlier.
+type persistedQueries struct {
+	registered map[string]string
+	// automatic is nil when queries aren't automatically persisted.
+	automatic *cache.Cache
+	// only rejects any query that isn't registered.
+	only bool
+}
+
+// newPersistedQueries registers the queries in PERSISTED_QUERIES_DIR, if set,
+// and only allows those when PERSISTED_QUERIES_ONLY is true. Queries are
+// only automatically persisted when CACHE_STORE is redis, as clients may
+// send any number of them and the memory store is unbounded.
+func newPersistedQueries() (*persistedQueries, error) {
+	registered := map[string]string{}
+	if dir := os.Getenv("PERSISTED_QUERIES_DIR"); dir != "" {
+		var err error
+		registered, err = loadPersistedQueries(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var automatic *cache.Cache
+	if os.Getenv("CACHE_STORE") == "redis" {
+		var err error
+		automatic, err = cache.NewFromEnv("queries")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &persistedQueries{
+		registered: registered,
+		automatic:  automatic,
+		only:       os.Getenv("PERSISTED_QUERIES_ONLY") == "true",
+	}, nil
+}
+
+// loadPersistedQueries reads every .graphql file in dir, keyed by the
+// SHA-256 of the file exactly as stored, trailing newline included, which is
+// how clients hash the files they're built with.
+func loadPersistedQueries(dir string) (map[string]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := map[string]string{}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".graphql" {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		query := string(b)
+		queries[queryHash(query)] = query
+	}
+
+	return queries, nil
+}
+
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolve fills in the query of a request sent by hash and persists new
+// queries sent along with their hash.
+func (p *persistedQueries) resolve(req *queryRequest) error {
+	ext := req.Extensions.PersistedQuery
+	if ext == nil {
+		if p.only && p.registered[queryHash(req.Query)] == "" {
+			return ErrPersistedQueryNotAllowed
+		}
+		return nil
+	}
+
+	if ext.Version != 1 {
+		return ErrPersistedQueryVersion
+	}
+
+	if req.Query == "" {
+		if query, ok := p.registered[ext.Sha256Hash]; ok {
+			req.Query = query
+			return nil
+		}
+
+		if p.only {
+			return ErrPersistedQueryNotFound
+		}
+
+		if p.automatic == nil {
+			return ErrPersistedQueryNotSupported
+		}
+
+		return p.automatic.Fetch(ext.Sha256Hash, &req.Query, func() error {
+			return ErrPersistedQueryNotFound
+		})
+	}
+
+	if queryHash(req.Query) != ext.Sha256Hash {
+		return ErrPersistedQueryHashMismatch
+	}
+
+	if _, ok := p.registered[ext.Sha256Hash]; ok {
+		return nil
+	}
+
+	if p.only {
+		return ErrPersistedQueryNotAllowed
+	}
+
+	// The query is still executed when it can't be persisted
+	err := p.automatic.Set(ext.Sha256Hash, req.Query)
+	if err != nil {
+		fmt.Printf("Unable to persist query %s: %v\n", ext.Sha256Hash, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"gopkg.in/mgutz/dat.v1/kvs"
+)
+
+func testPersistedQueries(t *testing.T, only bool) *persistedQueries {
+	registered, err := loadPersistedQueries("testdata/persisted")
+	assert.NoError(t, err)
+
+	return &persistedQueries{
+		registered: registered,
+		automatic:  cache.New("queries", kvs.NewMemoryKeyValueStore(time.Minute), time.Minute),
+		only:       only,
+	}
+}
+
+func persistedRequest(query string, hash string) *queryRequest {
+	req := &queryRequest{}
+	req.Query = query
+	if hash != "" {
+		req.Extensions.PersistedQuery = &persistedQueryExtension{Version: 1, Sha256Hash: hash}
+	}
+	return req
+}
+
+func TestLoadPersistedQueries(t *testing.T) {
+	queries, err := loadPersistedQueries("testdata/persisted")
+	assert.NoError(t, err)
+	assert.Len(t, queries, 1)
+
+	// Clients hash the file as it is, trailing newline included
+	b, _ := ioutil.ReadFile("testdata/persisted/superchargers.graphql")
+	assert.Equal(t, byte('\n'), b[len(b)-1])
+	query := queries[queryHash(string(b))]
+	assert.Equal(t, string(b), query)
+
+	p := testPersistedQueries(t, true)
+	assert.NoError(t, p.resolve(persistedRequest(string(b), "")))
+	assert.NoError(t, p.resolve(persistedRequest(string(b), queryHash(string(b)))))
+}
+
+func TestPersistedQueriesResolveByHash(t *testing.T) {
+	p := testPersistedQueries(t, false)
+
+	registered := ""
+	for hash := range p.registered {
+		registered = hash
+	}
+	req := persistedRequest("", registered)
+	assert.NoError(t, p.resolve(req))
+	assert.Contains(t, req.Query, "query Superchargers")
+
+	query := "{ __typename }"
+	hash := queryHash(query)
+	assert.Equal(t, ErrPersistedQueryNotFound, p.resolve(persistedRequest("", hash)))
+	assert.Equal(t, ErrPersistedQueryHashMismatch, p.resolve(persistedRequest("{ other }", hash)))
+	assert.NoError(t, p.resolve(persistedRequest(query, hash)))
+
+	req = persistedRequest("", hash)
+	assert.NoError(t, p.resolve(req))
+	assert.Equal(t, query, req.Query)
+
+	req = persistedRequest("", hash)
+	req.Extensions.PersistedQuery.Version = 2
+	assert.Equal(t, ErrPersistedQueryVersion, p.resolve(req))
+}
+
+func TestPersistedQueriesWithoutStore(t *testing.T) {
+	p := testPersistedQueries(t, false)
+	p.automatic = nil
+
+	query := "{ __typename }"
+	hash := queryHash(query)
+	assert.NoError(t, p.resolve(persistedRequest(query, hash)))
+	assert.Equal(t, ErrPersistedQueryNotSupported, p.resolve(persistedRequest("", hash)))
+
+	for hash := range p.registered {
+		assert.NoError(t, p.resolve(persistedRequest("", hash)))
+	}
+}
+
+func TestPersistedQueriesOnlyAllowsRegistered(t *testing.T) {
+	p := testPersistedQueries(t, true)
+
+	query := "{ __typename }"
+	assert.Equal(t, ErrPersistedQueryNotAllowed, p.resolve(persistedRequest(query, "")))
+	assert.Equal(t, ErrPersistedQueryNotAllowed, p.resolve(persistedRequest(query, queryHash(query))))
+	assert.Equal(t, ErrPersistedQueryNotFound, p.resolve(persistedRequest("", queryHash(query))))
+
+	for hash, registered := range p.registered {
+		assert.NoError(t, p.resolve(persistedRequest(registered, "")))
+		assert.NoError(t, p.resolve(persistedRequest("", hash)))
+	}
+}
+
+func TestGraphQLHandlerResolvesPersistedQueries(t *testing.T) {
+	var err error
+	Schema, err = BuildSchema()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, testPersistedQueries(t, false)))
+	defer server.Close()
+
+	query := "{ __typename }"
+	extensions := `{"persistedQuery":{"version":1,"sha256Hash":"` + queryHash(query) + `"}}`
+	get := func(values url.Values) map[string]interface{} {
+		res, err := http.Get(server.URL + "?" + values.Encode())
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		response := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+		return response
+	}
+
+	response := get(url.Values{"extensions": {extensions}})
+	code := response["errors"].([]interface{})[0].(map[string]interface{})["extensions"].(map[string]interface{})["code"]
+	assert.Equal(t, "PERSISTED_QUERY_NOT_FOUND", code)
+
+	response = get(url.Values{"query": {query}, "extensions": {extensions}})
+	assert.Equal(t, map[string]interface{}{"__typename": "Query"}, response["data"])
+
+	response = get(url.Values{"extensions": {extensions}})
+	assert.Equal(t, map[string]interface{}{"__typename": "Query"}, response["data"])
+}
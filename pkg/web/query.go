@@ -0,0 +1,416 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/printer"
+	"github.com/graphql-go/handler"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"golang.org/x/net/context"
+)
+
+var (
+	ErrInvalidVariables  = errors.New("Variables must be a JSON object")
+	ErrInvalidExtensions = errors.New("Extensions must be a JSON object")
+)
+
+// schemaMu serializes everything reading the types of the schema, which is
+// analyzing, validating and executing operations over HTTP and WebSockets
+// alike, as the vendored graphql rebuilds the fields of a type each time
+// they're read.
+var schemaMu sync.Mutex
+
+// graphQLQuery is an operation received over HTTP, parsed once so it can be
+// analyzed and cached before the handler executes it.
+type graphQLQuery struct {
+	handler.RequestOptions
+
+	// document is nil when the query doesn't parse, the handler reports why.
+	document  *ast.Document
+	operation *ast.OperationDefinition
+	cost      *queryCost
+}
+
+func parseQuery(opts *handler.RequestOptions) *graphQLQuery {
+	q := &graphQLQuery{RequestOptions: *opts}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: opts.Query})
+	if err != nil {
+		return q
+	}
+
+	q.document = doc
+	q.operation = selectOperation(doc, opts.OperationName)
+	return q
+}
+
+// prepareQuery resolves the query of req with persisted, unless it's nil, and
+// checks it's within defaultQueryLimits.
+func prepareQuery(schema *graphql.Schema, persisted *persistedQueries, req *queryRequest) (*graphQLQuery, error) {
+	if persisted != nil {
+		err := persisted.resolve(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	q := parseQuery(&req.RequestOptions)
+	err := q.analyze(schema, defaultQueryLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// selectOperation returns the operation named name, or the only operation
+// when name is empty. It's nil when there's no such operation.
+func selectOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var selected *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if name == "" {
+			if selected != nil {
+				return nil
+			}
+			selected = op
+			continue
+		}
+
+		if op.Name != nil && op.Name.Value == name {
+			return op
+		}
+	}
+
+	return selected
+}
+
+// key identifies a query by its normalized source, variables and operation
+// name so formatting doesn't change its key. It's false unless the requested
+// operation is a query.
+func (q *graphQLQuery) key() (string, bool) {
+	if q.operation == nil || q.operation.Operation != ast.OperationTypeQuery {
+		return "", false
+	}
+
+	variables, err := json.Marshal(q.Variables)
+	if err != nil {
+		return "", false
+	}
+
+	return cache.Key(fmt.Sprint(printer.Print(q.document)), string(variables), q.OperationName), true
+}
+
+// execute runs the query with h and returns the response, with the errors
+// of items within fields and the cost of the query in its extensions.
+func (q *graphQLQuery) execute(ctx context.Context, h *handler.Handler, r *http.Request) []byte {
+	errs := &fieldErrors{}
+	ctx = context.WithValue(ctx, fieldErrorsContextKey, errs)
+
+	body := handle(ctx, h, jsonRequest(r, &q.RequestOptions))
+
+	extensions := map[string]interface{}{}
+	if q.cost != nil {
+		extensions["cost"] = q.cost
+	}
+
+	return amendResponse(body, errs.errors, extensions)
+}
+
+// handle returns the response of h to r. The executor panics with the error
+// of a failing resolver rather than reporting it, which is recovered as a
+// response without data. The error keeps the code withErrorCodes gave it,
+// others are internal.
+func handle(ctx context.Context, h *handler.Handler, r *http.Request) (body []byte) {
+	defer func() {
+		if p := recover(); p != nil {
+			formatted, ok := p.(gqlerrors.FormattedError)
+			if !ok {
+				panic(p)
+			}
+
+			var coded *requestError
+			if errs := fieldErrorsFrom(ctx); errs != nil {
+				errs.Lock()
+				coded = errs.failed
+				errs.Unlock()
+			}
+			if coded == nil {
+				coded = codedError(ctx, formatted)
+			}
+
+			body, _ = json.MarshalIndent(map[string]interface{}{
+				"data": nil,
+				"errors": []responseError{{
+					Message:    coded.message,
+					Locations:  formatted.Locations,
+					Extensions: errorExtensions{Code: coded.code},
+				}},
+			}, "", "\t")
+		}
+	}()
+
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+
+	res := newBufferedResponse()
+	h.ContextHandler(ctx, res, r)
+	return res.body.Bytes()
+}
+
+// fieldErrors collects the errors of items within fields, the executor can
+// only report an error for the field as a whole, and the error of the
+// resolver that failed.
+type fieldErrors struct {
+	sync.Mutex
+	errors []responseError
+	failed *requestError
+}
+
+func fieldErrorsFrom(ctx context.Context) *fieldErrors {
+	if ctx == nil {
+		return nil
+	}
+
+	errs, _ := ctx.Value(fieldErrorsContextKey).(*fieldErrors)
+	return errs
+}
+
+// addFieldError reports err for the item at index of the field being
+// resolved. Only root fields are supported, as the executor doesn't tell
+// resolvers the path to their field.
+func addFieldError(ctx context.Context, info graphql.ResolveInfo, index int, err error) {
+	errs := fieldErrorsFrom(ctx)
+	if errs == nil {
+		return
+	}
+
+	key := info.FieldName
+	if len(info.FieldASTs) > 0 && info.FieldASTs[0].Alias != nil {
+		key = info.FieldASTs[0].Alias.Value
+	}
+
+	coded := codedError(ctx, err)
+
+	errs.Lock()
+	defer errs.Unlock()
+	errs.errors = append(errs.errors, responseError{
+		Message:    coded.message,
+		Path:       []interface{}{key, index},
+		Extensions: errorExtensions{Code: coded.code},
+	})
+}
+
+// amendResponse adds errors and extensions to an encoded response. Errors
+// the handler reported without a code are about the query, such as syntax
+// or validation errors.
+func amendResponse(body []byte, errs []responseError, extensions map[string]interface{}) []byte {
+	response := struct {
+		Data       json.RawMessage        `json:"data"`
+		Errors     []responseError        `json:"errors,omitempty"`
+		Extensions map[string]interface{} `json:"extensions,omitempty"`
+	}{}
+	err := json.Unmarshal(body, &response)
+	if err != nil {
+		return body
+	}
+
+	if len(response.Errors) == 0 && len(errs) == 0 && len(extensions) == 0 {
+		return body
+	}
+
+	for i := range response.Errors {
+		if response.Errors[i].Extensions.Code == "" {
+			response.Errors[i].Extensions.Code = codeBadUserInput
+		}
+	}
+	response.Errors = append(response.Errors, errs...)
+	response.Extensions = extensions
+
+	b, err := json.MarshalIndent(response, "", "\t")
+	if err != nil {
+		return body
+	}
+
+	return b
+}
+
+// requestError is an error with a stable code. When it rejects a request
+// before it's executed, it's encoded as a response with its code in the
+// extensions of the error, along with any extensions of the response.
+type requestError struct {
+	message    string
+	code       string
+	extensions map[string]interface{}
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func (e *requestError) MarshalJSON() ([]byte, error) {
+	response := map[string]interface{}{
+		"data": nil,
+		"errors": []responseError{{
+			Message:    e.message,
+			Extensions: errorExtensions{Code: e.code},
+		}},
+	}
+
+	if e.extensions != nil {
+		response["extensions"] = e.extensions
+	}
+
+	return json.MarshalIndent(response, "", "\t")
+}
+
+// errorResponse encodes err as a response, errors other than *requestError
+// are the client's fault.
+func errorResponse(err error) []byte {
+	reqErr, ok := err.(*requestError)
+	if !ok {
+		reqErr = &requestError{err.Error(), codeBadUserInput, nil}
+	}
+
+	body, _ := json.Marshal(reqErr)
+	return body
+}
+
+// writeResponse writes an encoded response to w.
+func writeResponse(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// queryRequest is a request to execute a query, its query may be missing
+// when it's sent by the hash in its extensions.
+type queryRequest struct {
+	handler.RequestOptions
+	Extensions queryExtensions `json:"extensions"`
+}
+
+// queryOptions reads the query from the URL, a form or the body. The handler
+// drops the variables of GET and form requests, so those are decoded here.
+func queryOptions(r *http.Request) (*queryRequest, error) {
+	values := r.URL.Query()
+	if values.Get("query") == "" && values.Get("extensions") == "" && strings.HasPrefix(r.Header.Get("Content-Type"), handler.ContentTypeFormURLEncoded) {
+		err := r.ParseForm()
+		if err != nil {
+			return nil, err
+		}
+		values = r.PostForm
+	}
+
+	if values.Get("query") == "" && values.Get("extensions") == "" {
+		return bodyOptions(r)
+	}
+
+	req := &queryRequest{
+		RequestOptions: handler.RequestOptions{
+			Query:         values.Get("query"),
+			OperationName: values.Get("operationName"),
+		},
+	}
+
+	if variables := values.Get("variables"); variables != "" {
+		err := json.Unmarshal([]byte(variables), &req.Variables)
+		if err != nil {
+			return nil, ErrInvalidVariables
+		}
+	}
+
+	if extensions := values.Get("extensions"); extensions != "" {
+		err := json.Unmarshal([]byte(extensions), &req.Extensions)
+		if err != nil {
+			return nil, ErrInvalidExtensions
+		}
+	}
+
+	return req, nil
+}
+
+// bodyOptions reads the query from the body as the handler would, along with
+// the extensions of JSON bodies.
+func bodyOptions(r *http.Request) (*queryRequest, error) {
+	if r.Method != "POST" || r.Body == nil {
+		return &queryRequest{}, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	req := &queryRequest{RequestOptions: *handler.NewRequestOptions(r)}
+
+	// Other content types have no extensions, so errors are ignored
+	extensions := struct {
+		Extensions queryExtensions `json:"extensions"`
+	}{}
+	json.Unmarshal(body, &extensions)
+	req.Extensions = extensions.Extensions
+
+	return req, nil
+}
+
+// jsonRequest copies r as a JSON POST of opts, which the handler decodes in
+// full.
+func jsonRequest(r *http.Request, opts *handler.RequestOptions) *http.Request {
+	body, _ := json.Marshal(opts)
+
+	u := *r.URL
+	u.RawQuery = ""
+
+	req := *r
+	req.Method = "POST"
+	req.URL = &u
+	req.Header = http.Header{}
+	for name, values := range r.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", handler.ContentTypeJSON)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	return &req
+}
+
+// bufferedResponse captures the body the handler writes.
+type bufferedResponse struct {
+	header http.Header
+	body   *bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{
+		header: http.Header{},
+		body:   &bytes.Buffer{},
+	}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(int) {}
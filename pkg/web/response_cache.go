@@ -0,0 +1,215 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/location"
+	"golang.org/x/net/context"
+)
+
+// responseMaxAge is how long clients and CDNs may reuse a response without
+// revalidating it, matching the feeds.
+const responseMaxAge = 5 * time.Minute
+
+// errUncacheable stops a response with errors from being cached, they're
+// often caused by the database and shouldn't outlive it.
+var errUncacheable = errors.New("Response has errors")
+
+// responseCache serves GraphQL queries with an ETag hashed from the body and a
+// Last-Modified derived from the last successful sync and the changes to
+// locations since, as responses can only change when the locations do. Bodies
+// are kept in cache until the locations change.
+type responseCache struct {
+	cache    *cache.Cache
+	lastSync func() *location.SyncRun
+
+	// changedAt is when this process was last notified of a change to the
+	// locations.
+	sync.Mutex
+	changedAt time.Time
+}
+
+// cachedResponse is the body of a response as stored in the cache.
+type cachedResponse struct {
+	Body []byte
+}
+
+var lastSync = struct {
+	sync.Mutex
+	run    *location.SyncRun
+	loaded bool
+}{}
+
+// newResponseCache caches responses in the store configured by CACHE_STORE,
+// discarding them whenever the locations change.
+func newResponseCache() (*responseCache, error) {
+	c, err := cache.NewFromEnv("responses")
+	if err != nil {
+		return nil, err
+	}
+
+	return &responseCache{
+		cache:    c,
+		lastSync: lastSuccessfulSync,
+	}, nil
+}
+
+// listenForSyncs keeps the last successful sync current and the cached
+// responses fresh across every process.
+func (rc *responseCache) listenForSyncs() error {
+	err := database.Listen(location.SyncRunsChannel, func(payload string) {
+		run := &location.SyncRun{}
+		err := json.Unmarshal([]byte(payload), run)
+		if err != nil {
+			fmt.Printf("Unable to decode sync run: %v\n", err)
+			return
+		}
+
+		if run.Status == location.SyncRunSucceeded {
+			setLastSync(run)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return location.OnChange(func(ids []int64) {
+		// Sync runs may have been missed while reconnecting
+		if ids == nil {
+			forgetLastSync()
+		}
+
+		rc.changed(time.Now())
+
+		err := rc.cache.Invalidate()
+		if err != nil {
+			fmt.Printf("Unable to invalidate cache %s: %v\n", rc.cache.Name, err)
+		}
+	})
+}
+
+// changed records a change to the locations, so responses are no longer
+// modified since before it.
+func (rc *responseCache) changed(at time.Time) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	rc.changedAt = at
+}
+
+func (rc *responseCache) lastChange() time.Time {
+	rc.Lock()
+	defer rc.Unlock()
+
+	return rc.changedAt
+}
+
+// lastSuccessfulSync returns the last successful sync, loading it the first
+// time. It's nil when there hasn't been one or it can't be loaded.
+func lastSuccessfulSync() *location.SyncRun {
+	lastSync.Lock()
+	defer lastSync.Unlock()
+
+	if !lastSync.loaded {
+		run, err := location.LastSuccessfulSync()
+		if err != nil {
+			fmt.Printf("Unable to load the last successful sync: %v\n", err)
+			return nil
+		}
+
+		lastSync.run = run
+		lastSync.loaded = true
+	}
+
+	return lastSync.run
+}
+
+func setLastSync(run *location.SyncRun) {
+	lastSync.Lock()
+	defer lastSync.Unlock()
+
+	lastSync.run = run
+	lastSync.loaded = true
+}
+
+func forgetLastSync() {
+	lastSync.Lock()
+	defer lastSync.Unlock()
+
+	lastSync.loaded = false
+}
+
+// serve answers the query from the cache when possible, calling execute
+// otherwise. Admin requests, mutations and anything that can't be parsed skip
+// the cache.
+func (rc *responseCache) serve(ctx context.Context, w http.ResponseWriter, r *http.Request, q *graphQLQuery, execute func() []byte) {
+	w.Header().Set("Vary", "Authorization")
+
+	key, ok := q.key()
+	run := rc.lastSync()
+	if !ok || run == nil || run.FinishedAt == nil || ctx.Value(adminContextKey) == true {
+		w.Header().Set("Cache-Control", "private, no-store")
+		writeResponse(w, execute())
+		return
+	}
+
+	key = cache.Key(key, fmt.Sprint(run.ID))
+	updated := *run.FinishedAt
+	if changedAt := rc.lastChange(); changedAt.After(updated) {
+		updated = changedAt
+	}
+
+	response := &cachedResponse{}
+	err := rc.cache.Fetch(key, response, func() error {
+		response.Body = execute()
+
+		if hasErrors(response.Body) {
+			return errUncacheable
+		}
+		return nil
+	})
+	if err == errUncacheable {
+		w.Header().Set("Cache-Control", "no-cache")
+		writeResponse(w, response.Body)
+		return
+	}
+
+	// Hashed from the body so every process agrees on it
+	etag := responseETag(response.Body)
+	setCacheHeaders(w, etag, updated)
+	if notModified(r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since"), etag, updated) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeResponse(w, response.Body)
+}
+
+func responseETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func setCacheHeaders(w http.ResponseWriter, etag string, updated time.Time) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(responseMaxAge.Seconds())))
+}
+
+func hasErrors(body []byte) bool {
+	result := struct {
+		Errors []json.RawMessage `json:"errors"`
+	}{}
+
+	err := json.Unmarshal(body, &result)
+	return err != nil || len(result.Errors) > 0
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/cache"
+	"github.com/wattapp/superchargers/pkg/location"
+	"gopkg.in/mgutz/dat.v1/kvs"
+)
+
+// countingServer serves a schema whose fields count how often they resolve.
+func countingServer(t *testing.T, run *location.SyncRun) (*httptest.Server, *responseCache, *int) {
+	calls := 0
+	field := &graphql.Field{
+		Type: graphql.String,
+		Args: graphql.FieldConfigArgument{
+			"name": &graphql.ArgumentConfig{Type: graphql.String},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			calls++
+			name, _ := p.Args["name"].(string)
+			return "hello " + name, nil
+		},
+	}
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:    graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: graphql.Fields{"hello": field}}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: graphql.Fields{"hello": field}}),
+	})
+	assert.NoError(t, err)
+
+	responses := &responseCache{
+		cache: cache.New("responses", kvs.NewMemoryKeyValueStore(time.Minute), time.Minute),
+		lastSync: func() *location.SyncRun {
+			return run
+		},
+	}
+
+	return httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &schema}), responses, nil)), responses, &calls
+}
+
+func get(t *testing.T, server *httptest.Server, query string, variables string, header http.Header) *http.Response {
+	values := url.Values{"query": {query}, "variables": {variables}}
+	req, err := http.NewRequest("GET", server.URL+"?"+values.Encode(), nil)
+	assert.NoError(t, err)
+	for name, value := range header {
+		req.Header[name] = value
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	return res
+}
+
+func TestResponseCacheRevalidatesWithETag(t *testing.T) {
+	finishedAt := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	server, _, calls := countingServer(t, &location.SyncRun{ID: 1, FinishedAt: &finishedAt})
+	defer server.Close()
+
+	query := `query Hello($name: String) { hello(name: $name) }`
+	res := get(t, server, query, `{"name":"world"}`, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "public, max-age=300", res.Header.Get("Cache-Control"))
+	assert.Equal(t, "Sat, 01 Oct 2016 12:00:00 GMT", res.Header.Get("Last-Modified"))
+	etag := res.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, 1, *calls)
+
+	// Formatting doesn't matter, variables do
+	res = get(t, server, "query Hello($name: String) {\n  hello(name: $name)\n}", `{"name":"world"}`, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+
+	res = get(t, server, query, `{"name":"there"}`, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NotEqual(t, etag, res.Header.Get("ETag"))
+	assert.Equal(t, 2, *calls)
+
+	res = get(t, server, query, `{"name":"world"}`, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, etag, res.Header.Get("ETag"))
+	assert.Equal(t, 2, *calls)
+}
+
+func TestResponseCacheRevalidatesAfterChanges(t *testing.T) {
+	finishedAt := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	server, responses, calls := countingServer(t, &location.SyncRun{ID: 1, FinishedAt: &finishedAt})
+	defer server.Close()
+
+	res := get(t, server, "{ hello }", "", nil)
+	etag := res.Header.Get("ETag")
+	assert.Equal(t, 1, *calls)
+
+	// A location updated outside of a sync
+	responses.changed(finishedAt.Add(time.Hour))
+	responses.cache.Invalidate()
+
+	// The body didn't change, so neither does the ETag
+	res = get(t, server, "{ hello }", "", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	assert.Equal(t, etag, res.Header.Get("ETag"))
+	assert.Equal(t, "Sat, 01 Oct 2016 13:00:00 GMT", res.Header.Get("Last-Modified"))
+	assert.Equal(t, 2, *calls)
+}
+
+func TestResponseCacheAgreesAcrossProcesses(t *testing.T) {
+	finishedAt := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	run := &location.SyncRun{ID: 1, FinishedAt: &finishedAt}
+	server, _, _ := countingServer(t, run)
+	defer server.Close()
+	other, _, calls := countingServer(t, run)
+	defer other.Close()
+
+	res := get(t, server, "{ hello }", "", nil)
+	etag := res.Header.Get("ETag")
+
+	res = get(t, other, "{ hello }", "", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	assert.Equal(t, etag, res.Header.Get("ETag"))
+	assert.Equal(t, 1, *calls)
+}
+
+func TestResponseCacheSkipsMutations(t *testing.T) {
+	finishedAt := time.Now()
+	server, _, calls := countingServer(t, &location.SyncRun{ID: 1, FinishedAt: &finishedAt})
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		res, err := http.Post(server.URL, "application/json", strings.NewReader(`{"query":"mutation { hello }"}`))
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, "private, no-store", res.Header.Get("Cache-Control"))
+		assert.Empty(t, res.Header.Get("ETag"))
+	}
+	assert.Equal(t, 2, *calls)
+}
+
+func TestResponseCacheSkipsWithoutSync(t *testing.T) {
+	server, _, calls := countingServer(t, nil)
+	defer server.Close()
+
+	get(t, server, "{ hello }", "", nil)
+	res := get(t, server, "{ hello }", "", nil)
+	assert.Equal(t, "private, no-store", res.Header.Get("Cache-Control"))
+	assert.Equal(t, 2, *calls)
+}
+
+func TestQueryOptionsRejectsInvalidVariables(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/graphql?query={hello}&variables=nope", nil)
+	_, err := queryOptions(req)
+	assert.Equal(t, ErrInvalidVariables, err)
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/relay"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+// searchField finds locations by name and address, most relevant first.
+func searchField() *graphql.Field {
+	connection := relay.ConnectionDefinitions(relay.ConnectionConfig{
+		Name:     "LocationSearch",
+		NodeType: locationType,
+		EdgeFields: graphql.Fields{
+			"node": &graphql.Field{
+				Type:        locationType,
+				Description: "The matching location.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return searchResult(p).Location, nil
+				},
+			},
+			"rank": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "How relevant the location is, only comparable within the same search.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return searchResult(p).Rank, nil
+				},
+			},
+			"snippet": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The name and address of the location with the matching words wrapped in <mark> and </mark>, which isn't HTML escaped.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return searchResult(p).Snippet, nil
+				},
+			},
+		},
+		ConnectionFields: graphql.Fields{
+			"totalCount": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "The number of locations matching the search.",
+			},
+		},
+	})
+
+	args := relay.NewConnectionArgs(graphql.FieldConfigArgument{
+		"query": &graphql.ArgumentConfig{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "Words of the name, address, city, state or postal code. Phrases may be quoted, OR matches either word and -word excludes it.",
+		},
+	})
+	for _, name := range []string{"type", "country"} {
+		args[name] = locationFieldArguments[name]
+	}
+
+	return costly(fieldCost{Weight: 1, DefaultSize: database.DefaultLimit}, &graphql.Field{
+		Type:        connection.ConnectionType,
+		Description: "Searches locations by name and address, the most relevant first.",
+		Args:        args,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			scope := database.NewGraphQLScopeWithFilters(p.Args)
+			results, err := location.Search(p.Args["query"].(string), scope)
+			if err != nil {
+				return nil, err
+			}
+
+			return newSearchConnection(results, scope.ConnectionArguments), nil
+		},
+	})
+}
+
+// searchConnection is a connection with the total number of results.
+type searchConnection struct {
+	Edges      []*relay.Edge  `json:"edges"`
+	PageInfo   relay.PageInfo `json:"pageInfo"`
+	TotalCount int            `json:"totalCount"`
+}
+
+func newSearchConnection(results *location.SearchResults, args relay.ConnectionArguments) *searchConnection {
+	nodes := []interface{}{}
+	for _, r := range results.Results {
+		nodes = append(nodes, r)
+	}
+
+	conn := relay.ConnectionFromArraySlice(nodes, args, relay.ArraySliceMetaInfo{
+		SliceStart:  results.Offset,
+		ArrayLength: results.Total,
+	})
+
+	return &searchConnection{
+		Edges:      conn.Edges,
+		PageInfo:   conn.PageInfo,
+		TotalCount: results.Total,
+	}
+}
+
+func searchResult(p graphql.ResolveParams) location.SearchResult {
+	return p.Source.(*relay.Edge).Node.(location.SearchResult)
+}
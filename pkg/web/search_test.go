@@ -0,0 +1,41 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/graphql-go/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+func TestSearchFieldTakesFilters(t *testing.T) {
+	args := searchField().Args
+	for _, name := range []string{"query", "type", "country", "first", "after", "last", "before"} {
+		assert.Contains(t, args, name)
+	}
+	assert.NotContains(t, args, "boundingBox")
+}
+
+func TestNewSearchConnection(t *testing.T) {
+	results := &location.SearchResults{
+		Results: []location.SearchResult{
+			{Location: &location.Location{ID: 7}, Rank: 0.5, Snippet: "<mark>Gilroy</mark>, CA"},
+			{Location: &location.Location{ID: 3}, Rank: 0.2, Snippet: "<mark>Gilroy</mark> Premium Outlets"},
+		},
+		Offset: 2,
+		Total:  10,
+	}
+
+	args := relay.NewConnectionArguments(map[string]interface{}{
+		"first": 2,
+		"after": string(relay.OffsetToCursor(1)),
+	})
+	conn := newSearchConnection(results, args)
+
+	assert.Equal(t, 10, conn.TotalCount)
+	assert.Len(t, conn.Edges, 2)
+	assert.Equal(t, relay.OffsetToCursor(2), conn.Edges[0].Cursor)
+	assert.Equal(t, results.Results[1], conn.Edges[1].Node)
+	assert.Equal(t, relay.OffsetToCursor(3), conn.PageInfo.EndCursor)
+	assert.True(t, conn.PageInfo.HasNextPage)
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/relay"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/location"
+)
+
+var enumStatsDimension = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "StatsDimension",
+	Description: "What locations may be grouped by when counting them.",
+	Values: graphql.EnumValueConfigMap{
+		"TYPE": &graphql.EnumValueConfig{
+			Value:       "type",
+			Description: "A location with several types is counted once for each of them.",
+		},
+		"COUNTRY": &graphql.EnumValueConfig{
+			Value: "country",
+		},
+		"REGION": &graphql.EnumValueConfig{
+			Value: "region",
+		},
+		"SUB_REGION": &graphql.EnumValueConfig{
+			Value: "subRegion",
+		},
+		"OPEN_SOON": &graphql.EnumValueConfig{
+			Value: "openSoon",
+		},
+		"IS_GALLERY": &graphql.EnumValueConfig{
+			Value: "isGallery",
+		},
+	},
+})
+
+var statsGroupType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "StatsGroup",
+	Description: "The locations sharing the values of the dimensions they were grouped by, the others are null.",
+	Fields: graphql.Fields{
+		"type": &graphql.Field{
+			Type: enumLocationType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return stringValue(p.Source.(location.StatsGroup).Type), nil
+			},
+		},
+		"country": &graphql.Field{
+			Type: enumCountry,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return stringValue(p.Source.(location.StatsGroup).Country), nil
+			},
+		},
+		"region": &graphql.Field{
+			Type: enumRegion,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return stringValue(p.Source.(location.StatsGroup).Region), nil
+			},
+		},
+		"subRegion": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return stringValue(p.Source.(location.StatsGroup).SubRegion), nil
+			},
+		},
+		"openSoon": &graphql.Field{
+			Type: graphql.Boolean,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return boolValue(p.Source.(location.StatsGroup).OpenSoon), nil
+			},
+		},
+		"isGallery": &graphql.Field{
+			Type: graphql.Boolean,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return boolValue(p.Source.(location.StatsGroup).IsGallery), nil
+			},
+		},
+		"count": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The number of locations in the group.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(location.StatsGroup).Count, nil
+			},
+		},
+		"stalls": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The total of Supercharger stalls of the locations that tell how many they have.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(location.StatsGroup).Stalls, nil
+			},
+		},
+		"knownStalls": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The number of locations that tell how many Supercharger stalls they have.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(location.StatsGroup).KnownStalls, nil
+			},
+		},
+	},
+})
+
+// statsField counts locations in the database rather than having clients
+// download every location to count them.
+func statsField() *graphql.Field {
+	args := graphql.FieldConfigArgument{
+		"groupBy": &graphql.ArgumentConfig{
+			Type:        graphql.NewList(graphql.NewNonNull(enumStatsDimension)),
+			Description: "The dimensions to group locations by, a single group of every location when omitted.",
+		},
+	}
+
+	// The same filters as locations, there's nothing to page through
+	for name, arg := range locationFieldArguments {
+		if _, ok := relay.ConnectionArgs[name]; !ok {
+			args[name] = arg
+		}
+	}
+
+	return costly(fieldCost{Weight: 1, DefaultSize: 50}, &graphql.Field{
+		Type:        graphql.NewList(statsGroupType),
+		Description: "Counts the locations matching the filters, grouped by any combination of dimensions. The largest groups come first.",
+		Args:        args,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			scope := database.NewGraphQLScopeWithFilters(p.Args)
+			return location.Stats(scope, groupByArgument(p.Args))
+		},
+	})
+}
+
+// groupByArgument reads the dimensions of the optional groupBy argument.
+func groupByArgument(args map[string]interface{}) []string {
+	dimensions := []string{}
+	groupBy, _ := args["groupBy"].([]interface{})
+	for _, d := range groupBy {
+		dimensions = append(dimensions, d.(string))
+	}
+
+	return dimensions
+}
+
+// stringValue is v, or null when it's nil as the executor doesn't treat nil
+// pointers as null.
+func stringValue(v *string) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// boolValue is v, or null when it's nil.
+func boolValue(v *bool) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
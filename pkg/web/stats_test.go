@@ -0,0 +1,28 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupByArgument(t *testing.T) {
+	assert.Equal(t, []string{}, groupByArgument(map[string]interface{}{}))
+	assert.Equal(t, []string{}, groupByArgument(map[string]interface{}{"groupBy": nil}))
+
+	dimensions := groupByArgument(map[string]interface{}{
+		"groupBy": []interface{}{"country", "openSoon"},
+		"region":  []interface{}{"europe"},
+	})
+	assert.Equal(t, []string{"country", "openSoon"}, dimensions)
+}
+
+func TestStringValue(t *testing.T) {
+	s := "europe"
+	assert.Equal(t, "europe", stringValue(&s))
+	assert.Nil(t, stringValue(nil))
+
+	b := true
+	assert.Equal(t, true, boolValue(&b))
+	assert.Nil(t, boolValue(nil))
+}
@@ -0,0 +1,601 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/handler"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/location"
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+	"golang.org/x/net/context"
+)
+
+// Message types of the graphql-ws protocol used by subscriptions-transport-ws
+const (
+	gqlConnectionInit      = "connection_init"
+	gqlConnectionAck       = "connection_ack"
+	gqlConnectionError     = "connection_error"
+	gqlConnectionKeepAlive = "ka"
+	gqlConnectionTerminate = "connection_terminate"
+	gqlStart               = "start"
+	gqlStop                = "stop"
+	gqlData                = "data"
+	gqlError               = "error"
+	gqlComplete            = "complete"
+)
+
+const (
+	subscriptionKeepAlive = 20 * time.Second
+	// subscriptionBuffer is how many notifications may wait on a client
+	// before publishing waits for it to catch up.
+	subscriptionBuffer = 256
+	// subscriptionSendTimeout is how long publishing waits on a client whose
+	// buffer is full before disconnecting it, so a sync changing many
+	// locations at once is delivered to clients that keep reading.
+	subscriptionSendTimeout = 10 * time.Second
+	// subscriptionReadLimit caps the size of a client message.
+	subscriptionReadLimit = 64 * 1024
+)
+
+var (
+	ErrSubscriptionsOverWebSocket = apierror.New(apierror.BadUserInput, "Subscriptions are only available over a graphql-ws WebSocket on /graphql")
+	ErrNotSubscription            = apierror.New(apierror.BadUserInput, "Only subscription operations can be started")
+)
+
+var fieldChangeType *graphql.Object
+var locationChangeType *graphql.Object
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{"graphql-ws"},
+	// The API is public, any page may subscribe
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// subscriptionRoot is the root value subscriptions are executed against, only
+// one of its fields is set for each notification.
+type subscriptionRoot struct {
+	Event   *location.Event
+	SyncRun *location.SyncRun
+}
+
+type subscriptionContextKey string
+
+const matchedContextKey subscriptionContextKey = "matched"
+
+// matched counts the root fields with data for a notification, when none do
+// nothing is sent.
+func matched(ctx context.Context) {
+	if count, ok := ctx.Value(matchedContextKey).(*int); ok {
+		*count++
+	}
+}
+
+func subscriptionSource(p graphql.ResolveParams) (*subscriptionRoot, error) {
+	root, ok := p.Source.(*subscriptionRoot)
+	if !ok {
+		return nil, ErrSubscriptionsOverWebSocket
+	}
+	return root, nil
+}
+
+func buildSubscriptionType() *graphql.Object {
+	fieldChangeType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "FieldChange",
+		Description: "A field of a location that changed, old and new are JSON encoded.",
+		Fields: graphql.Fields{
+			"field": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					c := p.Source.(supercharger.FieldChange)
+					return c.Field, nil
+				},
+			},
+			"old": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					c := p.Source.(supercharger.FieldChange)
+					return jsonString(c.Old)
+				},
+			},
+			"new": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					c := p.Source.(supercharger.FieldChange)
+					return jsonString(c.New)
+				},
+			},
+		},
+	})
+
+	locationChangeType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "LocationChange",
+		Fields: graphql.Fields{
+			"event": &graphql.Field{
+				Type: enumLocationEvent,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					e := p.Source.(*location.Event)
+					return e.Type, nil
+				},
+			},
+			"location": &graphql.Field{
+				Type:        locationType,
+				Description: "The location after the change, or as it was before being removed.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					e := p.Source.(*location.Event)
+					return e.Location, nil
+				},
+			},
+			"changes": &graphql.Field{
+				Type:        graphql.NewList(fieldChangeType),
+				Description: "The changed fields of an updated or opened location.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					e := p.Source.(*location.Event)
+					return e.Changes, nil
+				},
+			},
+		},
+	})
+
+	locationChangeFilter := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "LocationChangeFilter",
+		Description: "Empty fields match every change.",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"events": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewList(enumLocationEvent),
+			},
+			"type": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewList(enumLocationType),
+			},
+			"country": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewList(enumCountry),
+			},
+			"region": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewList(enumRegion),
+			},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: withErrorCodes(graphql.Fields{
+			"locationChanged": &graphql.Field{
+				Type:        locationChangeType,
+				Description: "Each location added, updated, opened or removed by a sync.",
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{
+						Type: locationChangeFilter,
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					root, err := subscriptionSource(p)
+					if err != nil {
+						return nil, err
+					}
+
+					if root.Event == nil {
+						return nil, nil
+					}
+
+					args, _ := p.Args["filter"].(map[string]interface{})
+					filter := location.EventFilter{
+						Events:        stringList(args["events"]),
+						LocationTypes: stringList(args["type"]),
+						Countries:     stringList(args["country"]),
+						Regions:       stringList(args["region"]),
+					}
+					if !filter.Matches(*root.Event) {
+						return nil, nil
+					}
+
+					matched(p.Context)
+					return root.Event, nil
+				},
+			},
+			"syncCompleted": &graphql.Field{
+				Type:        syncRunType,
+				Description: "Each sync once it has finished, whether or not it succeeded.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					root, err := subscriptionSource(p)
+					if err != nil {
+						return nil, err
+					}
+
+					if root.SyncRun == nil {
+						return nil, nil
+					}
+
+					matched(p.Context)
+					return root.SyncRun, nil
+				},
+			},
+		}),
+	})
+}
+
+func jsonString(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+type subscriptionHub struct {
+	sync.RWMutex
+	conns map[*subscriptionConn]struct{}
+}
+
+var hub = &subscriptionHub{
+	conns: map[*subscriptionConn]struct{}{},
+}
+
+// listenForSubscriptions feeds subscriptions with the notifications of
+// whichever process ran the sync.
+func listenForSubscriptions() error {
+	err := database.Listen(location.EventsChannel, func(payload string) {
+		e := &location.Event{}
+		err := json.Unmarshal([]byte(payload), e)
+		if err != nil {
+			fmt.Printf("Unable to decode location event: %v\n", err)
+			return
+		}
+		hub.publish(&subscriptionRoot{Event: e})
+	})
+	if err != nil {
+		return err
+	}
+
+	return database.Listen(location.SyncRunsChannel, func(payload string) {
+		run := &location.SyncRun{}
+		err := json.Unmarshal([]byte(payload), run)
+		if err != nil {
+			fmt.Printf("Unable to decode sync run: %v\n", err)
+			return
+		}
+		hub.publish(&subscriptionRoot{SyncRun: run})
+	})
+}
+
+func (h *subscriptionHub) add(c *subscriptionConn) {
+	h.Lock()
+	defer h.Unlock()
+	h.conns[c] = struct{}{}
+}
+
+func (h *subscriptionHub) remove(c *subscriptionConn) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.conns, c)
+}
+
+// publish hands the notification to every connection, waiting on those
+// with a full buffer and disconnecting those that don't catch up within
+// subscriptionSendTimeout.
+func (h *subscriptionHub) publish(root *subscriptionRoot) {
+	h.RLock()
+	conns := make([]*subscriptionConn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.RUnlock()
+
+	for _, c := range conns {
+		select {
+		case c.notifications <- root:
+			continue
+		default:
+		}
+
+		timeout := time.NewTimer(subscriptionSendTimeout)
+		select {
+		case c.notifications <- root:
+		case <-c.done:
+		case <-timeout.C:
+			metrics.Incr("subscriptions.dropped")
+			c.close()
+		}
+		timeout.Stop()
+	}
+}
+
+type operationMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type startPayload struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+type subscription struct {
+	document      *ast.Document
+	operationName string
+	variables     map[string]interface{}
+}
+
+// subscriptionConn is a single graphql-ws client. Messages are only written
+// from run, reads happen in serveSubscriptions.
+type subscriptionConn struct {
+	ws            *websocket.Conn
+	ctx           context.Context
+	schema        graphql.Schema
+	notifications chan *subscriptionRoot
+	messages      chan operationMessage
+	done          chan struct{}
+	closeOnce     sync.Once
+
+	sync.Mutex
+	subscriptions map[string]*subscription
+}
+
+// serveSubscriptions upgrades the request and speaks graphql-ws until the
+// client disconnects.
+func serveSubscriptions(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with an error
+		return
+	}
+	ws.SetReadLimit(subscriptionReadLimit)
+
+	c := &subscriptionConn{
+		ws:            ws,
+		ctx:           ctx,
+		schema:        Schema,
+		notifications: make(chan *subscriptionRoot, subscriptionBuffer),
+		messages:      make(chan operationMessage, subscriptionBuffer),
+		done:          make(chan struct{}),
+		subscriptions: map[string]*subscription{},
+	}
+
+	hub.add(c)
+	defer hub.remove(c)
+	defer c.close()
+
+	metrics.Incr("subscriptions.connected")
+	go c.run()
+
+	for {
+		msg := operationMessage{}
+		err := ws.ReadJSON(&msg)
+		if err != nil {
+			return
+		}
+
+		if !c.handle(msg) {
+			return
+		}
+	}
+}
+
+// handle responds to a client message, returning false once the client is
+// done.
+func (c *subscriptionConn) handle(msg operationMessage) bool {
+	switch msg.Type {
+	case gqlConnectionInit:
+		c.send(operationMessage{Type: gqlConnectionAck})
+		c.send(operationMessage{Type: gqlConnectionKeepAlive})
+	case gqlStart:
+		sub, err := c.parse(msg.Payload)
+		if err != nil {
+			c.send(operationMessage{ID: msg.ID, Type: gqlError, Payload: errorsPayload(err)})
+			return true
+		}
+
+		c.Lock()
+		c.subscriptions[msg.ID] = sub
+		c.Unlock()
+	case gqlStop:
+		c.Lock()
+		delete(c.subscriptions, msg.ID)
+		c.Unlock()
+		c.send(operationMessage{ID: msg.ID, Type: gqlComplete})
+	case gqlConnectionTerminate:
+		return false
+	default:
+		payload, _ := json.Marshal(map[string]string{"message": fmt.Sprintf("Unknown message type %q", msg.Type)})
+		c.send(operationMessage{ID: msg.ID, Type: gqlConnectionError, Payload: payload})
+	}
+
+	return true
+}
+
+// parse validates a started operation, which must be a subscription within
+// defaultQueryLimits.
+func (c *subscriptionConn) parse(raw json.RawMessage) (*subscription, error) {
+	payload := startPayload{}
+	err := json.Unmarshal(raw, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: payload.Query})
+	if err != nil {
+		return nil, err
+	}
+
+	q := &graphQLQuery{
+		RequestOptions: handler.RequestOptions{Variables: payload.Variables},
+		document:       doc,
+		operation:      selectOperation(doc, payload.OperationName),
+	}
+
+	err = q.analyze(&c.schema, defaultQueryLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaMu.Lock()
+	validation := graphql.ValidateDocument(&c.schema, doc, nil)
+	schemaMu.Unlock()
+	if !validation.IsValid {
+		return nil, validationError(validation.Errors)
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if payload.OperationName != "" && (op.Name == nil || op.Name.Value != payload.OperationName) {
+			continue
+		}
+
+		if op.Operation != ast.OperationTypeSubscription {
+			return nil, ErrNotSubscription
+		}
+	}
+
+	return &subscription{
+		document:      doc,
+		operationName: payload.OperationName,
+		variables:     payload.Variables,
+	}, nil
+}
+
+// run writes queued messages and the result of each subscription for every
+// notification until the connection closes.
+func (c *subscriptionConn) run() {
+	keepAlive := time.NewTicker(subscriptionKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case msg := <-c.messages:
+			err = c.ws.WriteJSON(msg)
+		case root := <-c.notifications:
+			err = c.execute(root)
+		case <-keepAlive.C:
+			err = c.ws.WriteJSON(operationMessage{Type: gqlConnectionKeepAlive})
+		case <-c.done:
+			return
+		}
+
+		if err != nil {
+			c.close()
+			return
+		}
+	}
+}
+
+func (c *subscriptionConn) execute(root *subscriptionRoot) error {
+	c.Lock()
+	subs := map[string]*subscription{}
+	for id, sub := range c.subscriptions {
+		subs[id] = sub
+	}
+	c.Unlock()
+
+	for id, sub := range subs {
+		count := 0
+		result := executeSubscription(graphql.ExecuteParams{
+			Schema:        c.schema,
+			Root:          root,
+			AST:           sub.document,
+			OperationName: sub.operationName,
+			Args:          sub.variables,
+			Context:       context.WithValue(c.ctx, matchedContextKey, &count),
+		})
+
+		if count == 0 && len(result.Errors) == 0 {
+			continue
+		}
+
+		payload, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		err = c.ws.WriteJSON(operationMessage{ID: id, Type: gqlData, Payload: payload})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// executeSubscription runs a subscription for a notification. The executor
+// panics with the error of a failing resolver rather than reporting it,
+// which is recovered as a result without data like handle does for queries.
+func executeSubscription(params graphql.ExecuteParams) (result *graphql.Result) {
+	defer func() {
+		if p := recover(); p != nil {
+			formatted, ok := p.(gqlerrors.FormattedError)
+			if !ok {
+				panic(p)
+			}
+
+			result = &graphql.Result{Errors: []gqlerrors.FormattedError{formatted}}
+		}
+	}()
+
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+
+	return graphql.Execute(params)
+}
+
+func (c *subscriptionConn) send(msg operationMessage) {
+	select {
+	case c.messages <- msg:
+	case <-c.done:
+	}
+}
+
+func (c *subscriptionConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+}
+
+type validationError []gqlerrors.FormattedError
+
+func (e validationError) Error() string {
+	if len(e) == 0 {
+		return "Invalid subscription"
+	}
+	return e[0].Message
+}
+
+// errorsPayload encodes err for an error message, with its code when it
+// carries one.
+func errorsPayload(err error) json.RawMessage {
+	if e, ok := err.(codeCarrier); ok {
+		payload, _ := json.Marshal([]responseError{{Message: e.Error(), Extensions: errorExtensions{Code: e.Code()}}})
+		return payload
+	}
+
+	errs := []gqlerrors.FormattedError{}
+	if v, ok := err.(validationError); ok {
+		errs = v
+	} else {
+		errs = append(errs, gqlerrors.FormatError(err))
+	}
+
+	payload, _ := json.Marshal(errs)
+	return payload
+}
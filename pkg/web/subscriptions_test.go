@@ -0,0 +1,194 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/location"
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+func init() {
+	metrics.Connect()
+}
+
+func dialSubscriptions(t *testing.T) (*websocket.Conn, func()) {
+	var err error
+	Schema, err = BuildSchema()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(graphQLHandler(handler.New(&handler.Config{Schema: &Schema}), nil, nil))
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+
+	return ws, func() {
+		ws.Close()
+		server.Close()
+	}
+}
+
+func readMessage(t *testing.T, ws *websocket.Conn, msgType string) operationMessage {
+	for {
+		msg := operationMessage{}
+		err := ws.ReadJSON(&msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+// start subscribes and waits for the server to have handled it, which the
+// following connection_ack confirms as messages are handled in order.
+func start(t *testing.T, ws *websocket.Conn, id string, query string) {
+	payload, _ := json.Marshal(startPayload{Query: query})
+	assert.NoError(t, ws.WriteJSON(operationMessage{ID: id, Type: gqlStart, Payload: payload}))
+	assert.NoError(t, ws.WriteJSON(operationMessage{Type: gqlConnectionInit}))
+	readMessage(t, ws, gqlConnectionAck)
+}
+
+func TestSubscriptionLocationChanged(t *testing.T) {
+	ws, done := dialSubscriptions(t)
+	defer done()
+
+	assert.NoError(t, ws.WriteJSON(operationMessage{Type: gqlConnectionInit}))
+	readMessage(t, ws, gqlConnectionAck)
+
+	start(t, ws, "1", `subscription {
+		locationChanged(filter: {country: [CANADA]}) { event location { title } }
+	}`)
+	start(t, ws, "2", `subscription {
+		locationChanged(filter: {events: [OPENED]}) { event location { title } changes { field old new } }
+	}`)
+
+	hub.publish(&subscriptionRoot{Event: &location.Event{
+		Type: location.EventOpened,
+		Location: &location.Location{
+			ID: 12,
+			Supercharger: supercharger.Supercharger{
+				Title:   "Barstow, CA",
+				Country: "United States",
+			},
+		},
+		Changes: []supercharger.FieldChange{{Field: "open_soon", Old: true, New: false}},
+	}})
+
+	msg := readMessage(t, ws, gqlData)
+	assert.Equal(t, "2", msg.ID)
+	assert.JSONEq(t, `{"data":{"locationChanged":{
+		"event":"OPENED",
+		"location":{"title":"Barstow, CA"},
+		"changes":[{"field":"open_soon","old":"true","new":"false"}]
+	}}}`, string(msg.Payload))
+
+	hub.publish(&subscriptionRoot{SyncRun: &location.SyncRun{ID: 3}})
+	start(t, ws, "3", `subscription { syncCompleted { status } }`)
+	hub.publish(&subscriptionRoot{SyncRun: &location.SyncRun{ID: 4, Status: location.SyncRunSucceeded}})
+
+	msg = readMessage(t, ws, gqlData)
+	assert.Equal(t, "3", msg.ID)
+	assert.JSONEq(t, `{"data":{"syncCompleted":{"status":"SUCCEEDED"}}}`, string(msg.Payload))
+}
+
+func TestSubscriptionKeepsUpWithLargeSyncs(t *testing.T) {
+	ws, done := dialSubscriptions(t)
+	defer done()
+
+	start(t, ws, "1", `subscription { locationChanged { location { title } } }`)
+
+	// More changes than fit in the buffer of the connection, as a first sync
+	// publishes
+	changes := subscriptionBuffer * 3
+	go func() {
+		for i := 0; i < changes; i++ {
+			hub.publish(&subscriptionRoot{Event: &location.Event{
+				Type:     location.EventAdded,
+				Location: &location.Location{ID: int64(i), Supercharger: supercharger.Supercharger{Title: "Barstow, CA"}},
+			}})
+		}
+	}()
+
+	for i := 0; i < changes; i++ {
+		msg := readMessage(t, ws, gqlData)
+		assert.Equal(t, "1", msg.ID)
+	}
+}
+
+func TestSubscriptionRejectsQueries(t *testing.T) {
+	ws, done := dialSubscriptions(t)
+	defer done()
+
+	payload, _ := json.Marshal(startPayload{Query: `{ lastSuccessfulSync { id } }`})
+	assert.NoError(t, ws.WriteJSON(operationMessage{ID: "1", Type: gqlStart, Payload: payload}))
+
+	msg := readMessage(t, ws, gqlError)
+	assert.Equal(t, "1", msg.ID)
+	assert.Contains(t, string(msg.Payload), ErrNotSubscription.Error())
+	assert.Contains(t, string(msg.Payload), `"code":"BAD_USER_INPUT"`)
+
+	payload, _ = json.Marshal(startPayload{Query: `subscription { nope }`})
+	assert.NoError(t, ws.WriteJSON(operationMessage{ID: "2", Type: gqlStart, Payload: payload}))
+
+	msg = readMessage(t, ws, gqlError)
+	assert.Equal(t, "2", msg.ID)
+	assert.Contains(t, string(msg.Payload), "nope")
+}
+
+func TestSubscriptionStop(t *testing.T) {
+	ws, done := dialSubscriptions(t)
+	defer done()
+
+	start(t, ws, "1", `subscription { syncCompleted { id } }`)
+	assert.NoError(t, ws.WriteJSON(operationMessage{ID: "1", Type: gqlStop}))
+
+	msg := readMessage(t, ws, gqlComplete)
+	assert.Equal(t, "1", msg.ID)
+}
+
+func TestSubscriptionRejectsQueriesOverLimits(t *testing.T) {
+	ws, done := dialSubscriptions(t)
+	defer done()
+
+	aliases := []string{}
+	for i := 0; i <= defaultQueryLimits.MaxAliases; i++ {
+		aliases = append(aliases, fmt.Sprintf("s%d: syncCompleted { id }", i))
+	}
+
+	payload, _ := json.Marshal(startPayload{Query: "subscription { " + strings.Join(aliases, " ") + " }"})
+	assert.NoError(t, ws.WriteJSON(operationMessage{ID: "1", Type: gqlStart, Payload: payload}))
+
+	msg := readMessage(t, ws, gqlError)
+	assert.Equal(t, "1", msg.ID)
+	assert.Contains(t, string(msg.Payload), "more than the maximum of 20")
+}
+
+func TestSubscriptionRecoversFailingResolvers(t *testing.T) {
+	schema, err := BuildSchema()
+	assert.NoError(t, err)
+
+	doc, err := parser.Parse(parser.ParseParams{Source: `subscription { syncCompleted { id } }`})
+	assert.NoError(t, err)
+
+	// Only a subscriptionRoot may be the root of a subscription
+	result := executeSubscription(graphql.ExecuteParams{Schema: schema, AST: doc})
+
+	assert.Nil(t, result.Data)
+	assert.Len(t, result.Errors, 1)
+	assert.Equal(t, ErrSubscriptionsOverWebSocket.Error(), result.Errors[0].Message)
+}
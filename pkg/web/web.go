@@ -1,20 +1,37 @@
 package web
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/handler"
 	"github.com/labstack/echo"
+	"github.com/labstack/echo/engine"
 	"github.com/labstack/echo/engine/standard"
 	"github.com/labstack/echo/middleware"
+	"github.com/wattapp/superchargers/pkg/location"
 	"github.com/wattapp/superchargers/pkg/metrics"
+	"golang.org/x/net/context"
+)
+
+// maxBodySize caps the body of a GraphQL request, batches included.
+const maxBodySize = 1 << 20
+
+type contextKey string
+
+const (
+	adminContextKey       contextKey = "admin"
+	fieldErrorsContextKey contextKey = "fieldErrors"
+	requestIDContextKey   contextKey = "requestID"
 )
 
 var (
@@ -22,17 +39,30 @@ var (
 	isDyno           = os.Getenv("DYNO") != ""
 	encryptChallenge = os.Getenv("LETS_ENCRYPT_CHALLENGE")
 	encryptKey       = os.Getenv("LETS_ENCRYPT_KEY")
+	adminToken       = os.Getenv("ADMIN_TOKEN")
 )
 
-func Run() error {
+// Run serves the API until ctx is done, then stops accepting connections and
+// returns once the requests in flight have been answered.
+func Run(ctx context.Context) error {
 	var err error
 	Schema, err = BuildSchema()
 	if err != nil {
 		return err
 	}
 
+	go func() {
+		err := listenForSubscriptions()
+		if err != nil {
+			fmt.Printf("Unable to listen for subscriptions: %v\n", err)
+		}
+	}()
+
+	requests := newDrain()
+
 	e := echo.New()
 	e.Pre(redirectHTTPS)
+	e.Use(requests.track)
 	e.Use(recordMetrics)
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Format: "time=${time_rfc3339} method=${method} path=${path} host=${host} status=${status} bytes_in=${bytes_in} bytes_out=${bytes_out}\n",
@@ -45,19 +75,61 @@ func Run() error {
 	e.Get("/.well-known/acme-challenge/:challenge", letsEncrypt)
 	e.File("/graphiql", "public/graphiql.html")
 	e.File("/faq", "public/faq.html")
+	registerFeeds(e)
 
 	h := handler.New(&handler.Config{
 		Schema: &Schema,
 		Pretty: true,
 	})
 
-	e.Any("/graphql", standard.WrapHandler(h))
+	responses, err := newResponseCache()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		err := responses.listenForSyncs()
+		if err != nil {
+			fmt.Printf("Unable to listen for syncs: %v\n", err)
+		}
+	}()
+
+	persisted, err := newPersistedQueries()
+	if err != nil {
+		return err
+	}
+
+	e.Any("/graphql", standard.WrapHandler(graphQLHandler(h, responses, persisted)))
 
 	// Run the server
 	addr := fmt.Sprintf(":%s", os.Getenv("PORT"))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
 
-	err = e.Run(standard.New(addr))
-	return err
+	server := standard.WithConfig(engine.Config{Address: addr, Listener: ln})
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- e.Run(server)
+	}()
+
+	select {
+	case err := <-stopped:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Answer the requests in flight without waiting for more on their
+	// connections
+	server.SetKeepAlivesEnabled(false)
+	err = ln.Close()
+	if err != nil {
+		return err
+	}
+
+	<-requests.wait()
+	return nil
 }
 
 func letsEncrypt(c echo.Context) error {
@@ -69,6 +141,82 @@ func letsEncrypt(c echo.Context) error {
 	return errors.New("Let's Encrypt challenge did not match")
 }
 
+// graphQLHandler serves queries and mutations within defaultQueryLimits over
+// HTTP, alone or batched in a JSON array, and subscriptions over WebSocket.
+// Queries sent by hash are resolved with persisted and responses are cached
+// with responses, unless either is nil. Requests carrying the ADMIN_TOKEN as
+// a bearer token are marked as admin, admin only fields are unavailable when
+// ADMIN_TOKEN is unset. Each request is given an ID, which internal errors
+// refer to.
+func graphQLHandler(h *handler.Handler, responses *responseCache, persisted *persistedQueries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r)
+		w.Header().Set("X-Request-Id", id)
+
+		ctx := context.WithValue(context.Background(), adminContextKey, isAdmin(r))
+		ctx = context.WithValue(ctx, requestIDContextKey, id)
+		if websocket.IsWebSocketUpgrade(r) {
+			serveSubscriptions(ctx, w, r)
+			return
+		}
+
+		ctx = location.WithLoader(ctx, location.NewLoader())
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		}
+
+		batch, ok, err := batchOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if ok {
+			w.Header().Set("Cache-Control", "private, no-store")
+			queries, errs := prepareBatch(h.Schema, persisted, batch)
+			writeResponse(w, executeBatch(ctx, len(batch), func(ctx context.Context, i int) []byte {
+				if errs[i] != nil {
+					return errorResponse(errs[i])
+				}
+				return queries[i].execute(ctx, h, r)
+			}))
+			return
+		}
+
+		req, err := queryOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		q, err := prepareQuery(h.Schema, persisted, req)
+		if err != nil {
+			writeResponse(w, errorResponse(err))
+			return
+		}
+
+		execute := func() []byte {
+			return q.execute(ctx, h, r)
+		}
+
+		if responses == nil {
+			writeResponse(w, execute())
+			return
+		}
+
+		responses.serve(ctx, w, r, q, execute)
+	})
+}
+
+func isAdmin(r *http.Request) bool {
+	if adminToken == "" {
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
 // Heroku specific HTTPS redirect
 func redirectHTTPS(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -0,0 +1,26 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAdmin(t *testing.T) {
+	defer func(token string) { adminToken = token }(adminToken)
+
+	r, _ := http.NewRequest("POST", "/graphql", nil)
+	adminToken = ""
+	assert.False(t, isAdmin(r))
+
+	r.Header.Set("Authorization", "Bearer ")
+	assert.False(t, isAdmin(r))
+
+	adminToken = "secret"
+	r.Header.Set("Authorization", "Bearer wrong")
+	assert.False(t, isAdmin(r))
+
+	r.Header.Set("Authorization", "Bearer secret")
+	assert.True(t, isAdmin(r))
+}
@@ -0,0 +1,366 @@
+package web
+
+import (
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/relay"
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/webhook"
+	"golang.org/x/net/context"
+)
+
+var ErrAdminRequired = apierror.New(apierror.Forbidden, "You must provide a valid admin token to manage webhooks")
+
+var webhookType *graphql.Object
+var webhookDeliveryType *graphql.Object
+
+func requireAdmin(ctx context.Context) error {
+	admin, _ := ctx.Value(adminContextKey).(bool)
+	if !admin {
+		return ErrAdminRequired
+	}
+	return nil
+}
+
+func stringList(v interface{}) database.StringList {
+	list := database.StringList{}
+	values, _ := v.([]interface{})
+	for _, value := range values {
+		list = append(list, value.(string))
+	}
+	return list
+}
+
+func buildWebhookTypes() {
+	webhookDeliveryType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "WebhookDelivery",
+		Description: "The log of posting a single event to a webhook.",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					return d.ID, nil
+				},
+			},
+			"guid": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Sent in the X-Superchargers-Delivery header and as the id of the payload.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					return d.GUID, nil
+				},
+			},
+			"event": &graphql.Field{
+				Type: enumLocationEvent,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					return d.Event, nil
+				},
+			},
+			"nid": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					return d.Nid, nil
+				},
+			},
+			"payload": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The JSON body that was posted.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					return d.Payload, nil
+				},
+			},
+			"statusCode": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "The HTTP status of the last attempt, null when no response was received.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					if d.StatusCode == nil {
+						return nil, nil
+					}
+					return *d.StatusCode, nil
+				},
+			},
+			"attempts": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					return d.Attempts, nil
+				},
+			},
+			"succeeded": &graphql.Field{
+				Type: graphql.Boolean,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					return d.Succeeded, nil
+				},
+			},
+			"error": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					if d.Error == nil {
+						return nil, nil
+					}
+					return *d.Error, nil
+				},
+			},
+			"pending": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Whether the delivery is still to be attempted.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					return d.Pending, nil
+				},
+			},
+			"nextAttemptAt": &graphql.Field{
+				Type:        graphql.String,
+				Description: "When the delivery is next attempted, null once it's no longer pending.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					if d.NextAttemptAt == nil {
+						return nil, nil
+					}
+					return d.NextAttemptAt.Format(time.RFC3339), nil
+				},
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d := p.Source.(*webhook.Delivery)
+					return d.CreatedAt.Format(time.RFC3339), nil
+				},
+			},
+		},
+	})
+
+	webhookType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Webhook",
+		Description: "A subscription posting location changes to a URL. Empty filters match everything.",
+		Fields: withCosts("Webhook", graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(*webhook.Webhook)
+					return w.ID, nil
+				},
+			},
+			"url": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(*webhook.Webhook)
+					return w.URL, nil
+				},
+			},
+			"events": &graphql.Field{
+				Type: graphql.NewList(enumLocationEvent),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(*webhook.Webhook)
+					return []string(w.Events), nil
+				},
+			},
+			"type": &graphql.Field{
+				Type: graphql.NewList(enumLocationType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(*webhook.Webhook)
+					return []string(w.LocationTypes), nil
+				},
+			},
+			"country": &graphql.Field{
+				Type: graphql.NewList(enumCountry),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(*webhook.Webhook)
+					return []string(w.Countries), nil
+				},
+			},
+			"region": &graphql.Field{
+				Type: graphql.NewList(enumRegion),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(*webhook.Webhook)
+					return []string(w.Regions), nil
+				},
+			},
+			"active": &graphql.Field{
+				Type: graphql.Boolean,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(*webhook.Webhook)
+					return w.Active, nil
+				},
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(*webhook.Webhook)
+					return w.CreatedAt.Format(time.RFC3339), nil
+				},
+			},
+			"deliveries": costly(fieldCost{Weight: 1, DefaultSize: database.DefaultLimit}, &graphql.Field{
+				Type:        graphql.NewList(webhookDeliveryType),
+				Description: "The most recent deliveries to this webhook.",
+				Args: graphql.FieldConfigArgument{
+					"first": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 10,
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(*webhook.Webhook)
+					first, _ := p.Args["first"].(int)
+					if first <= 0 || first > database.DefaultLimit {
+						first = database.DefaultLimit
+					}
+					return webhook.Deliveries(w.ID, first)
+				},
+			}),
+		}),
+	})
+}
+
+// webhookQueryFields require an admin token.
+func webhookQueryFields() graphql.Fields {
+	return graphql.Fields{
+		"webhooks": costly(fieldCost{Weight: 1, DefaultSize: database.DefaultLimit}, &graphql.Field{
+			Type:        graphql.NewList(webhookType),
+			Description: "Every webhook, requires an admin token.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				err := requireAdmin(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				return webhook.Webhooks()
+			},
+		}),
+	}
+}
+
+// webhookMutationFields require an admin token.
+func webhookMutationFields() graphql.Fields {
+	return graphql.Fields{
+		"createWebhook": relay.MutationWithClientMutationID(relay.MutationConfig{
+			Name: "CreateWebhook",
+			InputFields: graphql.InputObjectConfigFieldMap{
+				"url": &graphql.InputObjectFieldConfig{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "The URL receiving a POST for each event.",
+				},
+				"secret": &graphql.InputObjectFieldConfig{
+					Type:        graphql.String,
+					Description: "Used to sign payloads in the X-Superchargers-Signature header, generated when omitted.",
+				},
+				"events": &graphql.InputObjectFieldConfig{
+					Type: graphql.NewList(enumLocationEvent),
+				},
+				"type": &graphql.InputObjectFieldConfig{
+					Type: graphql.NewList(enumLocationType),
+				},
+				"country": &graphql.InputObjectFieldConfig{
+					Type: graphql.NewList(enumCountry),
+				},
+				"region": &graphql.InputObjectFieldConfig{
+					Type: graphql.NewList(enumRegion),
+				},
+			},
+			OutputFields: graphql.Fields{
+				"webhook": &graphql.Field{
+					Type: webhookType,
+				},
+				"secret": &graphql.Field{
+					Type:        graphql.String,
+					Description: "The signing secret, only returned when the webhook is created.",
+				},
+			},
+			MutateAndGetPayload: func(inputMap map[string]interface{}, info graphql.ResolveInfo, ctx context.Context) (map[string]interface{}, error) {
+				err := requireAdmin(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				secret, _ := inputMap["secret"].(string)
+				w := &webhook.Webhook{
+					URL:           inputMap["url"].(string),
+					Secret:        secret,
+					Events:        stringList(inputMap["events"]),
+					LocationTypes: stringList(inputMap["type"]),
+					Countries:     stringList(inputMap["country"]),
+					Regions:       stringList(inputMap["region"]),
+				}
+
+				err = webhook.Create(w)
+				if err != nil {
+					return nil, err
+				}
+
+				return map[string]interface{}{
+					"webhook": w,
+					"secret":  w.Secret,
+				}, nil
+			},
+		}),
+		"setWebhookActive": relay.MutationWithClientMutationID(relay.MutationConfig{
+			Name: "SetWebhookActive",
+			InputFields: graphql.InputObjectConfigFieldMap{
+				"id": &graphql.InputObjectFieldConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"active": &graphql.InputObjectFieldConfig{
+					Type: graphql.NewNonNull(graphql.Boolean),
+				},
+			},
+			OutputFields: graphql.Fields{
+				"webhook": &graphql.Field{
+					Type: webhookType,
+				},
+			},
+			MutateAndGetPayload: func(inputMap map[string]interface{}, info graphql.ResolveInfo, ctx context.Context) (map[string]interface{}, error) {
+				err := requireAdmin(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				w, err := webhook.SetActive(int64(inputMap["id"].(int)), inputMap["active"].(bool))
+				if err != nil {
+					return nil, err
+				}
+
+				return map[string]interface{}{
+					"webhook": w,
+				}, nil
+			},
+		}),
+		"deleteWebhook": relay.MutationWithClientMutationID(relay.MutationConfig{
+			Name: "DeleteWebhook",
+			InputFields: graphql.InputObjectConfigFieldMap{
+				"id": &graphql.InputObjectFieldConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			OutputFields: graphql.Fields{
+				"deletedWebhookId": &graphql.Field{
+					Type: graphql.Int,
+				},
+			},
+			MutateAndGetPayload: func(inputMap map[string]interface{}, info graphql.ResolveInfo, ctx context.Context) (map[string]interface{}, error) {
+				err := requireAdmin(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				id := int64(inputMap["id"].(int))
+				err = webhook.Delete(id)
+				if err != nil {
+					return nil, err
+				}
+
+				return map[string]interface{}{
+					"deletedWebhookId": id,
+				}, nil
+			},
+		}),
+	}
+}
@@ -0,0 +1,355 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/location"
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+	"golang.org/x/net/context"
+	"gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const (
+	SignatureHeader = "X-Superchargers-Signature"
+	EventHeader     = "X-Superchargers-Event"
+	DeliveryHeader  = "X-Superchargers-Delivery"
+	// claimLease is how long a claimed delivery is left to its worker,
+	// longer than posting it can take.
+	claimLease = time.Minute
+)
+
+// Payload is the JSON body posted to webhooks for each event.
+type Payload struct {
+	ID        string                     `json:"id"`
+	Event     string                     `json:"event"`
+	CreatedAt time.Time                  `json:"created_at"`
+	Location  PayloadLocation            `json:"location"`
+	Changes   []supercharger.FieldChange `json:"changes,omitempty"`
+}
+
+// PayloadLocation adds the Relay global ID to the location.
+type PayloadLocation struct {
+	NodeID string `json:"node_id"`
+	*location.Location
+}
+
+// Delivery is the log of posting a single event to a webhook. It's pending
+// until it has succeeded or failed for good, NextAttemptAt is when it's due.
+type Delivery struct {
+	ID            int64      `db:"id"`
+	WebhookID     int64      `db:"webhook_id"`
+	GUID          string     `db:"guid"`
+	Event         string     `db:"event"`
+	Nid           int64      `db:"nid"`
+	Payload       string     `db:"payload"`
+	StatusCode    *int       `db:"status_code"`
+	Attempts      int        `db:"attempts"`
+	Succeeded     bool       `db:"succeeded"`
+	Error         *string    `db:"error"`
+	Pending       bool       `db:"pending"`
+	NextAttemptAt *time.Time `db:"next_attempt_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+// Deliveries returns the most recent deliveries for the webhook.
+func Deliveries(webhookID int64, limit int) ([]*Delivery, error) {
+	deliveries := []*Delivery{}
+	err := database.Conn().
+		Select("*").
+		From("webhook_deliveries").
+		Where("webhook_id = $1", webhookID).
+		OrderBy("id DESC").
+		Limit(uint64(limit)).
+		QueryStructs(&deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Enqueue records a pending delivery of every event of the sync to each
+// active webhook it matches, for a Dispatcher to post. It's registered with
+// location.OnSync so the deliveries commit with the sync.
+func Enqueue(conn runner.Connection, result *location.SyncResult) error {
+	if len(result.Events) == 0 {
+		return nil
+	}
+
+	hooks, err := webhooks(conn, true)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, w := range hooks {
+		for _, e := range result.Events {
+			if !w.Matches(e) {
+				continue
+			}
+
+			delivery, err := newDelivery(w, e, now)
+			if err != nil {
+				return err
+			}
+
+			err = delivery.insert(conn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// newDelivery builds the pending delivery of the event to the webhook, due
+// right away.
+func newDelivery(w *Webhook, e location.Event, now time.Time) (*Delivery, error) {
+	guid, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(Payload{
+		ID:        guid,
+		Event:     e.Type,
+		CreatedAt: now,
+		Location: PayloadLocation{
+			NodeID:   e.Location.ToGlobalID(),
+			Location: e.Location,
+		},
+		Changes: e.Changes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Delivery{
+		WebhookID:     w.ID,
+		GUID:          guid,
+		Event:         e.Type,
+		Nid:           e.Location.Nid,
+		Payload:       string(body),
+		Pending:       true,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	}, nil
+}
+
+func (d *Delivery) insert(conn runner.Connection) error {
+	return conn.
+		InsertInto("webhook_deliveries").
+		Columns("webhook_id", "guid", "event", "nid", "payload", "attempts", "succeeded", "pending", "next_attempt_at", "created_at").
+		Record(d).
+		Returning("id").
+		QueryScalar(&d.ID)
+}
+
+func (d *Delivery) save() error {
+	_, err := database.Conn().
+		Update("webhook_deliveries").
+		SetWhitelist(d, "status_code", "attempts", "succeeded", "error", "pending", "next_attempt_at").
+		Where("id = $1", d.ID).
+		Exec()
+	return err
+}
+
+// claimDeliveries returns up to limit pending deliveries that are due to
+// active webhooks, oldest first, pushing their next attempt back by
+// claimLease so no other worker claims them meanwhile. Deliveries claimed by
+// a worker that died are retried once the lease runs out.
+func claimDeliveries(limit int, now time.Time) ([]*Delivery, error) {
+	deliveries := []*Delivery{}
+	err := database.Conn().SQL(`
+		UPDATE webhook_deliveries SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT webhook_deliveries.id
+			FROM webhook_deliveries
+			INNER JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+			WHERE webhook_deliveries.pending AND webhooks.active AND webhook_deliveries.next_attempt_at <= $2
+			ORDER BY webhook_deliveries.next_attempt_at, webhook_deliveries.id
+			LIMIT $3
+			FOR UPDATE OF webhook_deliveries SKIP LOCKED
+		)
+		RETURNING *
+	`, now.Add(claimLease), now, limit).QueryStructs(&deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Sign returns the signature sent in the X-Superchargers-Signature header,
+// receivers should compute it over the raw body with their secret and compare.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher posts the pending deliveries to their webhooks.
+type Dispatcher struct {
+	Client *http.Client
+	// MaxAttempts caps how many times a delivery is tried.
+	MaxAttempts int
+	// RetryDelay is the wait after the first failed attempt, doubling after
+	// each further one up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// Workers caps how many deliveries are posted at once.
+	Workers int
+	// PollInterval is how often due deliveries are looked for once there
+	// are none left.
+	PollInterval time.Duration
+}
+
+// DefaultDispatcher retries a failed delivery up to 5 times over roughly 15
+// minutes, posting up to 4 at once.
+var DefaultDispatcher = &Dispatcher{
+	Client:        &http.Client{Timeout: 10 * time.Second},
+	MaxAttempts:   5,
+	RetryDelay:    time.Minute,
+	MaxRetryDelay: 10 * time.Minute,
+	Workers:       4,
+	PollInterval:  5 * time.Second,
+}
+
+// Run posts the pending deliveries that are due until ctx is cancelled, then
+// returns once the posts in flight are done. Deliveries to a webhook aren't
+// posted in order once one of them is retried, receivers can order them by
+// their created_at.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := claimDeliveries(d.Workers, time.Now().UTC())
+		if err != nil {
+			fmt.Printf("Unable to claim webhook deliveries: %v\n", err)
+		}
+
+		if len(deliveries) > 0 {
+			d.deliverAll(deliveries)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(d.PollInterval):
+		}
+	}
+}
+
+// deliverAll posts each delivery concurrently and saves the outcome.
+func (d *Dispatcher) deliverAll(deliveries []*Delivery) {
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *Delivery) {
+			defer wg.Done()
+
+			w, err := GetWebhook(delivery.WebhookID)
+			if err != nil {
+				fmt.Printf("Unable to load webhook %d for delivery %s: %v\n", delivery.WebhookID, delivery.GUID, err)
+				return
+			}
+
+			d.Deliver(w, delivery, time.Now().UTC())
+			err = delivery.save()
+			if err != nil {
+				fmt.Printf("Unable to record delivery %s to webhook %d: %v\n", delivery.GUID, w.ID, err)
+			}
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+// Deliver makes one attempt at posting the delivery to the webhook. A
+// success or a failure that isn't worth retrying ends the delivery, other
+// failures schedule the next attempt until MaxAttempts. The delivery has not
+// been saved.
+func (d *Dispatcher) Deliver(w *Webhook, delivery *Delivery, now time.Time) {
+	delivery.Attempts++
+	retry, err := d.post(w, delivery, []byte(delivery.Payload))
+	if err == nil {
+		delivery.Succeeded = true
+		delivery.Error = nil
+		delivery.Pending = false
+		delivery.NextAttemptAt = nil
+		metrics.Incr("webhook.delivered")
+		return
+	}
+	delivery.fail(err)
+
+	if retry && delivery.Attempts < d.MaxAttempts {
+		next := now.Add(d.retryDelay(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		return
+	}
+
+	delivery.Pending = false
+	delivery.NextAttemptAt = nil
+	metrics.Incr("webhook.failed")
+}
+
+// retryDelay returns the wait after the given number of failed attempts.
+func (d *Dispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.RetryDelay
+	for i := 1; i < attempts && delay < d.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > d.MaxRetryDelay {
+		return d.MaxRetryDelay
+	}
+
+	return delay
+}
+
+// post makes a single attempt, reporting whether a failure is worth retrying.
+func (d *Dispatcher) post(w *Webhook, delivery *Delivery, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Superchargers.io-Webhooks")
+	req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.GUID)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	status := resp.StatusCode
+	delivery.StatusCode = &status
+
+	if status >= 200 && status < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("Received status %d", status)
+	retry := status >= 500 || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout
+	return retry, err
+}
+
+func (d *Delivery) fail(err error) {
+	msg := err.Error()
+	d.Error = &msg
+}
@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"github.com/wattapp/superchargers/pkg/apierror"
+	"github.com/wattapp/superchargers/pkg/database"
+	"github.com/wattapp/superchargers/pkg/location"
+	"gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+var (
+	ErrWebhookNotFound = apierror.New(apierror.NotFound, "Webhook not found")
+	ErrInvalidURL      = apierror.New(apierror.BadUserInput, "Webhook URL must be an absolute http or https URL")
+	ErrInvalidEvent    = apierror.New(apierror.BadUserInput, "Webhook events must be one of added, updated, removed or opened")
+)
+
+var events = []string{
+	location.EventAdded,
+	location.EventUpdated,
+	location.EventRemoved,
+	location.EventOpened,
+}
+
+// Webhook is a subscription to location changes. Empty filters match every
+// event, location type, country or region.
+type Webhook struct {
+	ID            int64               `db:"id"`
+	URL           string              `db:"url"`
+	Secret        string              `db:"secret"`
+	Events        database.StringList `db:"events"`
+	LocationTypes database.StringList `db:"location_types"`
+	Countries     database.StringList `db:"countries"`
+	Regions       database.StringList `db:"regions"`
+	Active        bool                `db:"active"`
+	UpdatedAt     time.Time           `db:"updated_at"`
+	CreatedAt     time.Time           `db:"created_at"`
+}
+
+// Create validates and stores a new webhook, generating its secret unless one
+// was provided.
+func Create(w *Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+		return ErrInvalidURL
+	}
+
+	for _, e := range w.Events {
+		if !database.StringList(events).Includes(e) {
+			return ErrInvalidEvent
+		}
+	}
+
+	if w.Secret == "" {
+		w.Secret, err = randomHex(32)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Active = true
+	w.CreatedAt = time.Now().UTC()
+	w.UpdatedAt = w.CreatedAt
+
+	return database.Conn().
+		InsertInto("webhooks").
+		Columns("url", "secret", "events", "location_types", "countries", "regions", "active", "updated_at", "created_at").
+		Record(w).
+		Returning("id").
+		QueryScalar(&w.ID)
+}
+
+// GetWebhook returns the webhook with the given id.
+func GetWebhook(id int64) (*Webhook, error) {
+	w := &Webhook{}
+	err := database.Conn().
+		Select("*").
+		From("webhooks").
+		Where("id = $1", id).
+		QueryStruct(w)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Webhooks returns every webhook, active or not.
+func Webhooks() ([]*Webhook, error) {
+	return webhooks(database.Conn(), false)
+}
+
+func webhooks(conn runner.Connection, activeOnly bool) ([]*Webhook, error) {
+	hooks := []*Webhook{}
+	builder := conn.
+		Select("*").
+		From("webhooks").
+		OrderBy("id")
+
+	if activeOnly {
+		builder = builder.Where("active = $1", true)
+	}
+
+	err := builder.QueryStructs(&hooks)
+	if err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// SetActive pauses or resumes deliveries to the webhook.
+func SetActive(id int64, active bool) (*Webhook, error) {
+	w := &Webhook{}
+	err := database.Conn().
+		Update("webhooks").
+		Set("active", active).
+		Set("updated_at", time.Now().UTC()).
+		Where("id = $1", id).
+		Returning("*").
+		QueryStruct(w)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Delete removes the webhook along with its delivery log.
+func Delete(id int64) error {
+	res, err := database.Conn().
+		DeleteFrom("webhooks").
+		Where("id = $1", id).
+		Exec()
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// Matches reports whether the event passes the webhook's filters.
+func (w Webhook) Matches(e location.Event) bool {
+	return location.EventFilter{
+		Events:        w.Events,
+		LocationTypes: w.LocationTypes,
+		Countries:     w.Countries,
+		Regions:       w.Regions,
+	}.Matches(e)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
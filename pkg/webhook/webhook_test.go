@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wattapp/superchargers/pkg/location"
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+func init() {
+	metrics.Connect()
+}
+
+func testDispatcher() *Dispatcher {
+	return &Dispatcher{
+		Client:        http.DefaultClient,
+		MaxAttempts:   3,
+		RetryDelay:    time.Minute,
+		MaxRetryDelay: 3 * time.Minute,
+	}
+}
+
+func testEvent(eventType string) location.Event {
+	return location.Event{
+		Type: eventType,
+		Location: &location.Location{
+			ID: 12,
+			Supercharger: supercharger.Supercharger{
+				Nid:          34,
+				Title:        "Barstow, CA",
+				Country:      "United States",
+				Region:       "north_america",
+				LocationType: supercharger.LocationList{"supercharger"},
+			},
+		},
+	}
+}
+
+func testDelivery(t *testing.T, hook *Webhook, eventType string) *Delivery {
+	delivery, err := newDelivery(hook, testEvent(eventType), testNow)
+	assert.NoError(t, err)
+	return delivery
+}
+
+var testNow = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestNewDeliveryIsPendingRightAway(t *testing.T) {
+	hook := &Webhook{ID: 1}
+	delivery := testDelivery(t, hook, location.EventAdded)
+
+	assert.True(t, delivery.Pending)
+	assert.Equal(t, testNow, *delivery.NextAttemptAt)
+	assert.Equal(t, 0, delivery.Attempts)
+	assert.Equal(t, int64(1), delivery.WebhookID)
+	assert.Equal(t, int64(34), delivery.Nid)
+	assert.Len(t, delivery.GUID, 32)
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer server.Close()
+
+	hook := &Webhook{ID: 1, URL: server.URL, Secret: "shh"}
+	delivery := testDelivery(t, hook, location.EventAdded)
+	testDispatcher().Deliver(hook, delivery, testNow)
+
+	assert.True(t, delivery.Succeeded)
+	assert.False(t, delivery.Pending)
+	assert.Nil(t, delivery.NextAttemptAt)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, 200, *delivery.StatusCode)
+	assert.Nil(t, delivery.Error)
+
+	assert.Equal(t, Sign("shh", body), header.Get(SignatureHeader))
+	assert.Equal(t, location.EventAdded, header.Get(EventHeader))
+	assert.Equal(t, delivery.GUID, header.Get(DeliveryHeader))
+
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, delivery.GUID, payload["id"])
+	assert.Equal(t, "added", payload["event"])
+
+	l := payload["location"].(map[string]interface{})
+	assert.Equal(t, "TG9jYXRpb246MTI=", l["node_id"])
+	assert.Equal(t, "Barstow, CA", l["title"])
+}
+
+func TestDeliverSchedulesRetryOfServerErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	hook := &Webhook{ID: 1, URL: server.URL, Secret: "shh"}
+	delivery := testDelivery(t, hook, location.EventUpdated)
+	d := testDispatcher()
+
+	d.Deliver(hook, delivery, testNow)
+	assert.True(t, delivery.Pending)
+	assert.False(t, delivery.Succeeded)
+	assert.Equal(t, testNow.Add(time.Minute), *delivery.NextAttemptAt)
+	assert.Equal(t, "Received status 502", *delivery.Error)
+
+	d.Deliver(hook, delivery, *delivery.NextAttemptAt)
+	assert.False(t, delivery.Pending)
+	assert.True(t, delivery.Succeeded)
+	assert.Nil(t, delivery.Error)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Equal(t, 2, requests)
+}
+
+func TestDeliverGivesUpAfterMaxAttempts(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	hook := &Webhook{ID: 1, URL: server.URL, Secret: "shh"}
+	delivery := testDelivery(t, hook, location.EventUpdated)
+	d := testDispatcher()
+	for i := 0; i < 5 && delivery.Pending; i++ {
+		d.Deliver(hook, delivery, testNow)
+	}
+
+	assert.False(t, delivery.Pending)
+	assert.False(t, delivery.Succeeded)
+	assert.Nil(t, delivery.NextAttemptAt)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, "Received status 503", *delivery.Error)
+}
+
+func TestDeliverDoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	hook := &Webhook{ID: 1, URL: server.URL, Secret: "shh"}
+	delivery := testDelivery(t, hook, location.EventRemoved)
+	testDispatcher().Deliver(hook, delivery, testNow)
+
+	assert.False(t, delivery.Pending)
+	assert.False(t, delivery.Succeeded)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, http.StatusGone, *delivery.StatusCode)
+}
+
+func TestRetryDelayDoublesUpToMax(t *testing.T) {
+	d := testDispatcher()
+
+	assert.Equal(t, time.Minute, d.retryDelay(1))
+	assert.Equal(t, 2*time.Minute, d.retryDelay(2))
+	assert.Equal(t, 3*time.Minute, d.retryDelay(3))
+	assert.Equal(t, 3*time.Minute, d.retryDelay(10))
+}
+
+func TestWebhookMatches(t *testing.T) {
+	event := testEvent(location.EventOpened)
+
+	assert.True(t, Webhook{}.Matches(event))
+	assert.True(t, Webhook{Events: []string{"opened"}, Countries: []string{"United States"}}.Matches(event))
+	assert.True(t, Webhook{LocationTypes: []string{"store", "supercharger"}}.Matches(event))
+	assert.True(t, Webhook{Regions: []string{"north_america"}}.Matches(event))
+
+	assert.False(t, Webhook{Events: []string{"added"}}.Matches(event))
+	assert.False(t, Webhook{Countries: []string{"Canada"}}.Matches(event))
+	assert.False(t, Webhook{LocationTypes: []string{"store"}}.Matches(event))
+	assert.False(t, Webhook{Regions: []string{"europe"}}.Matches(event))
+}
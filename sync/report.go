@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/wattapp/superchargers/pkg/location"
+	"github.com/wattapp/superchargers/pkg/supercharger"
+)
+
+type report struct {
+	DryRun    bool `json:"dry_run"`
+	Added     int  `json:"added"`
+	Updated   int  `json:"updated"`
+	Unchanged int  `json:"unchanged"`
+	Removed   int  `json:"removed"`
+
+	SnapshotHash string   `json:"snapshot_hash"`
+	BlockedBy    []string `json:"blocked_by"`
+
+	AddedLocations   []reportLocation `json:"added_locations"`
+	UpdatedLocations []reportUpdate   `json:"updated_locations"`
+	RemovedLocations []reportLocation `json:"removed_locations"`
+}
+
+type reportLocation struct {
+	Nid     int64  `json:"nid"`
+	Title   string `json:"title"`
+	Country string `json:"country"`
+}
+
+type reportUpdate struct {
+	reportLocation
+	Changes []supercharger.FieldChange `json:"changes"`
+}
+
+func newReportLocation(sc supercharger.Supercharger) reportLocation {
+	return reportLocation{
+		Nid:     sc.Nid,
+		Title:   sc.Title,
+		Country: sc.Country,
+	}
+}
+
+func newReport(result *location.SyncResult) report {
+	r := report{
+		DryRun:           result.DryRun,
+		Added:            result.Added,
+		Updated:          result.Updated,
+		Unchanged:        result.Unchanged,
+		Removed:          result.Removed,
+		SnapshotHash:     result.SnapshotHash,
+		BlockedBy:        []string{},
+		AddedLocations:   []reportLocation{},
+		UpdatedLocations: []reportUpdate{},
+		RemovedLocations: []reportLocation{},
+	}
+
+	r.BlockedBy = append(r.BlockedBy, result.BlockedBy...)
+
+	for _, sc := range result.AddedLocations {
+		r.AddedLocations = append(r.AddedLocations, newReportLocation(sc))
+	}
+
+	for _, u := range result.UpdatedLocations {
+		r.UpdatedLocations = append(r.UpdatedLocations, reportUpdate{
+			reportLocation: newReportLocation(u.Supercharger),
+			Changes:        u.Changes,
+		})
+	}
+
+	for _, l := range result.RemovedLocations {
+		r.RemovedLocations = append(r.RemovedLocations, newReportLocation(l.Supercharger))
+	}
+
+	return r
+}
+
+func (r report) writeJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func (r report) writeText(w io.Writer) error {
+	var buf bytes.Buffer
+	if r.DryRun {
+		fmt.Fprintln(&buf, "Dry run, no changes were applied")
+	}
+
+	fmt.Fprintf(&buf, "Added: %d, Updated: %d, Unchanged: %d, Removed: %d\n", r.Added, r.Updated, r.Unchanged, r.Removed)
+
+	for _, reason := range r.BlockedBy {
+		fmt.Fprintf(&buf, "Would be blocked, it %s\n", reason)
+	}
+
+	for _, l := range r.AddedLocations {
+		fmt.Fprintf(&buf, "+ nid=%d %s (%s)\n", l.Nid, l.Title, l.Country)
+	}
+
+	for _, u := range r.UpdatedLocations {
+		fmt.Fprintf(&buf, "~ nid=%d %s (%s)\n", u.Nid, u.Title, u.Country)
+		for _, c := range u.Changes {
+			fmt.Fprintf(&buf, "    %s: %s -> %s\n", c.Field, formatValue(c.Old), formatValue(c.New))
+		}
+	}
+
+	for _, l := range r.RemovedLocations {
+		fmt.Fprintf(&buf, "- nid=%d %s (%s)\n", l.Nid, l.Title, l.Country)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -1,24 +1,131 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
 
 	"github.com/wattapp/superchargers/pkg/database"
 	"github.com/wattapp/superchargers/pkg/location"
+	"github.com/wattapp/superchargers/pkg/metrics"
+	"github.com/wattapp/superchargers/pkg/webhook"
+	"golang.org/x/net/context"
+)
+
+var (
+	dryRun     = flag.Bool("dry-run", false, "Print the changes a sync would make without applying them")
+	format     = flag.String("format", "text", "Report format, either text or json")
+	maxAdded   = flag.Int("max-added", -1, "Exit non-zero when a dry run would add more locations than this")
+	maxUpdated = flag.Int("max-updated", -1, "Exit non-zero when a dry run would update more locations than this, defaults to SYNC_MAX_UPDATED_PERCENT of the stored locations")
+	maxRemoved = flag.Int("max-removed", -1, "Exit non-zero when a dry run would remove more locations than this, defaults to SYNC_MAX_REMOVED_PERCENT of the stored locations")
+	approve    = flag.Int64("approve", 0, "Approve the blocked sync with this id so its snapshot can be applied")
+	source     = flag.String("source", "script", "Recorded as the source of the sync run")
 )
 
 func main() {
-	fmt.Println("Starting to update all locations...")
-	_, err := database.Connect()
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown format %q, expected text or json\n", *format)
+		os.Exit(2)
+	}
+
+	if *format == "text" {
+		fmt.Println("Starting to update all locations...")
+	}
+
+	err := metrics.Connect()
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = database.Connect()
+	if err != nil {
+		panic(err)
+	}
+
+	if *approve > 0 {
+		approval, err := location.ApproveSync(*approve)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Approved sync %d, the next sync of snapshot %s will be applied\n", approval.ID, approval.SnapshotHash)
+		return
+	}
+
+	guards, err := location.SyncGuardsFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Webhook deliveries are queued with the sync, the web process posts them
+	location.OnSync(webhook.Enqueue)
+
+	result, err := location.Sync(context.Background(), location.SyncOptions{
+		DryRun: *dryRun,
+		Guards: guards,
+		Source: *source,
+	})
+	if blocked, ok := err.(*location.SyncBlockedError); ok {
+		fmt.Fprintln(os.Stderr, blocked)
+		fmt.Fprintf(os.Stderr, "Review the changes with --dry-run and approve them with --approve %d\n", blocked.ApprovalID)
+		os.Exit(1)
+	}
+
+	if unmapped, ok := err.(*location.UnmappedCountriesError); ok {
+		fmt.Fprintln(os.Stderr, unmapped)
+		fmt.Fprintln(os.Stderr, "Add them with their ISO 3166-1 codes to the catalog in pkg/country")
+		os.Exit(1)
+	}
+
 	if err != nil {
 		panic(err)
 	}
 
-	var added, updated int
-	added, updated, err = location.Sync()
+	r := newReport(result)
+	if *format == "json" {
+		err = r.writeJSON(os.Stdout)
+	} else {
+		err = r.writeText(os.Stdout)
+	}
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("Added: %d, Updated: %d\n", added, updated)
+	if !*dryRun {
+		return
+	}
+
+	// The report lists the guards the sync would be blocked by
+	exceeded := len(result.BlockedBy) > 0
+
+	previousTotal := result.PreviousTotal()
+	exceeded = checkThreshold("added", result.Added, *maxAdded) || exceeded
+	exceeded = checkThreshold("updated", result.Updated, thresholdOrGuard(*maxUpdated, guards.MaxUpdatedPercent, previousTotal)) || exceeded
+	exceeded = checkThreshold("removed", result.Removed, thresholdOrGuard(*maxRemoved, guards.MaxRemovedPercent, previousTotal)) || exceeded
+	if exceeded {
+		os.Exit(1)
+	}
+}
+
+// thresholdOrGuard returns max when it's set, and otherwise the share of the
+// previous total the guard allows, which a zero guard disables.
+func thresholdOrGuard(max int, guardPercent float64, previousTotal int) int {
+	if max >= 0 || guardPercent <= 0 || previousTotal == 0 {
+		return max
+	}
+
+	return int(guardPercent * float64(previousTotal) / 100)
+}
+
+// checkThreshold reports whether count is over max, a negative max disables
+// the check.
+func checkThreshold(name string, count, max int) bool {
+	if max < 0 || count <= max {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "Sync would have %s %d locations, more than the allowed %d\n", name, count, max)
+	return true
 }